@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// The ways to reach the target server, that are selected with the -via flag.
+const (
+	viaDirect         = "direct"
+	viaPortForward    = "port-forward"
+	viaAPIServerProxy = "apiserver-proxy"
+)
+
+// resolveVia returns the way to reach the server selected by -via, which is shared by get and repeat get.
+// It defaults to port-forward when the target of the port-forward is specified, direct otherwise.
+func resolveVia(via string, target portForwardTarget) (string, error) {
+	switch via {
+	case "":
+		if !target.IsZero() {
+			return viaPortForward, nil
+		}
+		return viaDirect, nil
+	case viaPortForward:
+		if target.IsZero() {
+			return "", fmt.Errorf("missing value for the flag %s, %s or %s required by -via %s", "-service", "-pod", "-selector", viaPortForward)
+		}
+		return via, nil
+	case viaDirect, viaAPIServerProxy:
+		return via, nil
+	}
+
+	return "", fmt.Errorf("unsupported value for -via: %q. It must be one of %s, %s, or %s", via, viaDirect, viaPortForward, viaAPIServerProxy)
+}
+
+// apiserverProxyTransport sends requests to a Kubernetes service or pod via the API server's proxy
+// at /api/v1/namespaces/{ns}/services/{name}:{port}/proxy/ or /api/v1/namespaces/{ns}/pods/{name}:{port}/proxy/.
+//
+// Only the path and the query of the original request URL are used.
+// The scheme and the host are replaced with those of the API server.
+type apiserverProxyTransport struct {
+	base     http.RoundTripper
+	proxyURL *url.URL
+}
+
+func (t *apiserverProxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *t.proxyURL
+	u.Path = path.Join(t.proxyURL.Path, req.URL.Path)
+	if strings.HasSuffix(req.URL.Path, "/") || req.URL.Path == "" {
+		u.Path += "/"
+	}
+	u.RawQuery = req.URL.RawQuery
+
+	r := req.Clone(req.Context())
+	r.URL = &u
+	r.Host = ""
+
+	return t.base.RoundTrip(r)
+}
+
+// newAPIServerProxyClient returns a HTTP client that sends every request to the port of the service or the pod
+// via the API server's proxy.
+func newAPIServerProxyClient(restConfig *rest.Config, target portForwardTarget, port int) (*http.Client, error) {
+	var resource, name string
+
+	switch {
+	case target.Service != "":
+		resource, name = "services", target.Service
+	case target.Pod != "":
+		resource, name = "pods", target.Pod
+	default:
+		return nil, fmt.Errorf("-via %s requires either -service or -pod", viaAPIServerProxy)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL := clientset.CoreV1().RESTClient().Get().
+		Namespace(target.Namespace).
+		Resource(resource).
+		Name(name + ":" + strconv.Itoa(port)).
+		SubResource("proxy").
+		URL()
+
+	return &http.Client{
+		Transport: &apiserverProxyTransport{
+			base:     transport,
+			proxyURL: proxyURL,
+		},
+	}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestResolveVia(t *testing.T) {
+	testcases := []struct {
+		name    string
+		via     string
+		target  portForwardTarget
+		want    string
+		wantErr string
+	}{
+		{name: "default without target", want: viaDirect},
+		{name: "default with target", target: portForwardTarget{Namespace: "default", Service: "wy-serve"}, want: viaPortForward},
+		{name: "direct with target", via: viaDirect, target: portForwardTarget{Namespace: "default", Service: "wy-serve"}, want: viaDirect},
+		{name: "port-forward", via: viaPortForward, target: portForwardTarget{Namespace: "default", Pod: "wy-serve-0"}, want: viaPortForward},
+		{name: "port-forward without target", via: viaPortForward, wantErr: "required by -via port-forward"},
+		{name: "apiserver-proxy", via: viaAPIServerProxy, target: portForwardTarget{Namespace: "default", Service: "wy-serve"}, want: viaAPIServerProxy},
+		{name: "unsupported", via: "ssh", wantErr: "It must be one of direct, port-forward, or apiserver-proxy"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveVia(tc.via, tc.target)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("unexpected via: want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAPIServerProxyClient(t *testing.T) {
+	testcases := []struct {
+		name      string
+		target    portForwardTarget
+		url       string
+		wantPath  string
+		wantQuery string
+	}{
+		{
+			name:      "service",
+			target:    portForwardTarget{Namespace: "default", Service: "wy-serve"},
+			url:       "http://localhost/get?foo=bar&baz=1",
+			wantPath:  "/api/v1/namespaces/default/services/wy-serve:8080/proxy/get",
+			wantQuery: "foo=bar&baz=1",
+		},
+		{
+			name:     "pod",
+			target:   portForwardTarget{Namespace: "kube-system", Pod: "wy-serve-0"},
+			url:      "http://localhost/a/b",
+			wantPath: "/api/v1/namespaces/kube-system/pods/wy-serve-0:8080/proxy/a/b",
+		},
+		{
+			name:     "trailing slash",
+			target:   portForwardTarget{Namespace: "default", Service: "wy-serve"},
+			url:      "http://localhost/a/",
+			wantPath: "/api/v1/namespaces/default/services/wy-serve:8080/proxy/a/",
+		},
+		{
+			name:     "root",
+			target:   portForwardTarget{Namespace: "default", Service: "wy-serve"},
+			url:      "http://localhost",
+			wantPath: "/api/v1/namespaces/default/services/wy-serve:8080/proxy/",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var got *http.Request
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			defer srv.Close()
+
+			client, err := newAPIServerProxyClient(&rest.Config{Host: srv.URL, BearerToken: "token"}, tc.target, 8080)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := client.Get(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if got == nil {
+				t.Fatal("the request didn't reach the API server")
+			}
+
+			if got.URL.Path != tc.wantPath {
+				t.Errorf("unexpected path: want %s, got %s", tc.wantPath, got.URL.Path)
+			}
+
+			if got.URL.RawQuery != tc.wantQuery {
+				t.Errorf("unexpected query: want %s, got %s", tc.wantQuery, got.URL.RawQuery)
+			}
+
+			if auth := got.Header.Get("Authorization"); auth != "Bearer token" {
+				t.Errorf("the request isn't authenticated to the API server: %q", auth)
+			}
+		})
+	}
+}
+
+func TestAPIServerProxyClientRequiresServiceOrPod(t *testing.T) {
+	_, err := newAPIServerProxyClient(&rest.Config{Host: "https://10.0.0.1:6443"}, portForwardTarget{Namespace: "default", Selector: "app=wy"}, 8080)
+	if err == nil || !strings.Contains(err.Error(), "requires either -service or -pod") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
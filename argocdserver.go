@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+)
+
+// argocdServerFlags holds the flags to fetch the clusters from the ArgoCD API server instead of the cluster secrets.
+type argocdServerFlags struct {
+	// server is the ArgoCD API server, in the form of a URL or HOST[:PORT]
+	server string
+	// authToken is the ArgoCD auth token, like the one generated with `argocd account generate-token`
+	authToken string
+	insecure  bool
+}
+
+func (f *argocdServerFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.server, "argocd-server", os.Getenv("ARGOCD_SERVER"), "The ArgoCD API server to fetch the clusters from instead of the cluster secrets, in the form of HOST[:PORT] or URL. Falls back to the cluster secrets when the API server is unavailable")
+	fs.StringVar(&f.authToken, "argocd-auth-token", os.Getenv("ARGOCD_AUTH_TOKEN"), "The ArgoCD auth token for -argocd-server")
+	fs.BoolVar(&f.insecure, "argocd-insecure", false, "Skip verifying the TLS certificate of -argocd-server")
+}
+
+// rejectArgocdServer registers -argocd-server to the commands that connect to the clusters, only to reject it.
+// The ArgoCD API server redacts the credentials of the clusters, so the commands can't connect to them without the cluster secrets.
+// Registering the flag gives a clear error instead of "flag provided but not defined".
+func rejectArgocdServer(fs *flag.FlagSet) {
+	fs.Func("argocd-server", "Not supported, as the ArgoCD API server redacts the credentials needed to connect to the clusters. This command always reads the credentials from -cluster-source", func(string) error {
+		return errors.New("this command can't fetch the clusters from the ArgoCD API server, as it redacts the credentials needed to connect to the clusters. Omit the flag and grant the permission to get the cluster secrets instead")
+	})
+}
+
+// listClustersFromAPIServer returns the clusters fetched from the ArgoCD API server.
+// The returned clusterSecrets have no secret names as there's no secret involved.
+func listClustersFromAPIServer(f argocdServerFlags) ([]clusterSecret, error) {
+	c, err := argocd.NewAPIClient(f.server, f.authToken, f.insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := c.ListClusters(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []clusterSecret
+
+	for i := range items {
+		clusters = append(clusters, clusterSecret{Cluster: &items[i]})
+	}
+
+	return clusters, nil
+}
+
+// listClustersWithFallback returns the clusters fetched from the ArgoCD API server when -argocd-server is set,
+// or the clusters read from the cluster source, which defaults to the cluster secrets in the namespace, otherwise.
+// It falls back to the cluster source when the API server failed.
+func listClustersWithFallback(kubeconfigPath, source, namespace string, f argocdServerFlags) ([]clusterSecret, error) {
+	if f.server != "" {
+		clusters, err := listClustersFromAPIServer(f)
+		if err == nil {
+			return clusters, nil
+		}
+
+		log.Printf("Unable to fetch clusters from the ArgoCD API server %s: %v. Falling back to the cluster secrets", f.server, err)
+	}
+
+	s, err := newClusterSource(source, kubeconfigPath, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return listClusters(s)
+}
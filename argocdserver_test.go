@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRejectArgocdServer(t *testing.T) {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	rejectArgocdServer(fs)
+
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error without the flag: %v", err)
+	}
+
+	err := fs.Parse([]string{"-argocd-server", "argocd.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "redacts the credentials") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
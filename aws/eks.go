@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/mumoshu/wy/aws/pkg/awsclicompat"
+	"github.com/mumoshu/wy/execcredential"
+	"github.com/spf13/cobra"
+)
+
+// eksAPIOptions is the flags of the eks sub-commands that call the EKS API.
+type eksAPIOptions struct {
+	Region  string
+	Profile string
+	// EndpointURL overrides the EKS API endpoint, like aws-cli's --endpoint-url.
+	// It's mainly for testing against a fake EKS API
+	EndpointURL string
+}
+
+func (o *eksAPIOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.Region, "region", "", "The region to use. Overrides config/env settings.")
+	cmd.Flags().StringVar(&o.Profile, "profile", "", "Use a specific profile from your credential file.")
+	cmd.Flags().StringVar(&o.EndpointURL, "endpoint-url", "", "Override the EKS API endpoint with the given URL.")
+}
+
+func (o eksAPIOptions) client(ctx context.Context) (*eks.Client, error) {
+	cfg, err := awsclicompat.LoadConfig(ctx, o.Region, o.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return eks.NewFromConfig(cfg, func(opts *eks.Options) {
+		if o.EndpointURL != "" {
+			opts.EndpointResolver = eks.EndpointResolverFromURL(o.EndpointURL)
+		}
+	}), nil
+}
+
+// eksCluster is the subset of the EKS cluster that `aws eks describe-cluster` prints, in the same JSON format as aws-cli.
+type eksCluster struct {
+	Name                 string                  `json:"name"`
+	Arn                  string                  `json:"arn"`
+	CreatedAt            *time.Time              `json:"createdAt,omitempty"`
+	Version              string                  `json:"version"`
+	Endpoint             string                  `json:"endpoint"`
+	RoleArn              string                  `json:"roleArn"`
+	Status               string                  `json:"status"`
+	CertificateAuthority eksCertificateAuthority `json:"certificateAuthority"`
+	PlatformVersion      string                  `json:"platformVersion"`
+	Tags                 map[string]string       `json:"tags,omitempty"`
+}
+
+type eksCertificateAuthority struct {
+	Data string `json:"data"`
+}
+
+func describeCluster(ctx context.Context, client *eks.Client, name string) (*eksCluster, error) {
+	out, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, awsclicompat.ClassifyError(fmt.Errorf("describing cluster %s: %w", name, err))
+	}
+
+	c := out.Cluster
+
+	cluster := &eksCluster{
+		Name:            aws.ToString(c.Name),
+		Arn:             aws.ToString(c.Arn),
+		CreatedAt:       c.CreatedAt,
+		Version:         aws.ToString(c.Version),
+		Endpoint:        aws.ToString(c.Endpoint),
+		RoleArn:         aws.ToString(c.RoleArn),
+		Status:          string(c.Status),
+		PlatformVersion: aws.ToString(c.PlatformVersion),
+		Tags:            c.Tags,
+	}
+
+	if c.CertificateAuthority != nil {
+		cluster.CertificateAuthority.Data = aws.ToString(c.CertificateAuthority.Data)
+	}
+
+	return cluster, nil
+}
+
+// eksListClusters prints the names of all the EKS clusters in the region, like `aws eks list-clusters`.
+func eksListClusters(out io.Writer, opts eksAPIOptions) error {
+	ctx := context.Background()
+
+	client, err := opts.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	// aws-cli prints an empty array rather than null when there's no cluster
+	clusters := []string{}
+
+	p := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return awsclicompat.ClassifyError(fmt.Errorf("listing clusters: %w", err))
+		}
+
+		clusters = append(clusters, page.Clusters...)
+	}
+
+	return printJSON(out, map[string]interface{}{"clusters": clusters})
+}
+
+// eksDescribeCluster prints the EKS cluster, like `aws eks describe-cluster`.
+func eksDescribeCluster(out io.Writer, opts eksAPIOptions, name string) error {
+	ctx := context.Background()
+
+	client, err := opts.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := describeCluster(ctx, client, name)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, map[string]interface{}{"cluster": cluster})
+}
+
+// updateKubeconfigOptions is the flags of `aws eks update-kubeconfig`.
+type updateKubeconfigOptions struct {
+	eksAPIOptions
+
+	Name       string
+	Kubeconfig string
+	RoleARN    string
+	// Alias is the name of the context. Defaults to the cluster ARN
+	Alias string
+	// UserAlias is the name of the user. Defaults to the cluster ARN
+	UserAlias string
+	DryRun    bool
+}
+
+// eksUpdateKubeconfig adds or updates the cluster, user and context for the EKS cluster in the kubeconfig file,
+// and sets the current context to it, like `aws eks update-kubeconfig`.
+//
+// Unlike aws-cli, the user runs `aws eks get-token` without --region, as the token signed in any region is accepted by EKS.
+// That way, the context can be converted into an ArgoCD cluster secret with awsAuthConfig by `wy print cluster-secret`.
+func eksUpdateKubeconfig(out io.Writer, opts updateKubeconfigOptions) error {
+	ctx := context.Background()
+
+	client, err := opts.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := describeCluster(ctx, client, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if cluster.Endpoint == "" || cluster.CertificateAuthority.Data == "" {
+		return fmt.Errorf("cluster %s has no endpoint or certificate authority yet. Its status is %s", opts.Name, cluster.Status)
+	}
+
+	path := opts.Kubeconfig
+	if path == "" {
+		path = defaultKubeconfigPath()
+	}
+
+	config, err := loadKubeconfig(path)
+	if err != nil {
+		return fmt.Errorf("loading kubeconfig %s: %w", path, err)
+	}
+
+	contextName := cluster.Arn
+	if opts.Alias != "" {
+		contextName = opts.Alias
+	}
+
+	userName := cluster.Arn
+	if opts.UserAlias != "" {
+		userName = opts.UserAlias
+	}
+
+	args := []interface{}{"eks", "get-token", "--cluster-name", cluster.Name}
+	if opts.RoleARN != "" {
+		args = append(args, "--role-arn", opts.RoleARN)
+	}
+
+	exec := map[string]interface{}{
+		"apiVersion": execcredential.APIVersionV1Beta1,
+		"command":    "aws",
+		"args":       args,
+	}
+
+	if opts.Profile != "" {
+		exec["env"] = []interface{}{
+			map[string]interface{}{"name": "AWS_PROFILE", "value": opts.Profile},
+		}
+	}
+
+	config.Clusters, _ = upsert(config.Clusters, kubeconfigEntry{
+		Name: cluster.Arn,
+		Cluster: map[string]interface{}{
+			"server":                     cluster.Endpoint,
+			"certificate-authority-data": cluster.CertificateAuthority.Data,
+		},
+	})
+
+	config.Users, _ = upsert(config.Users, kubeconfigEntry{
+		Name: userName,
+		User: map[string]interface{}{"exec": exec},
+	})
+
+	var updated bool
+
+	config.Contexts, updated = upsert(config.Contexts, kubeconfigEntry{
+		Name: contextName,
+		Context: map[string]interface{}{
+			"cluster": cluster.Arn,
+			"user":    userName,
+		},
+	})
+
+	config.CurrentContext = contextName
+
+	if opts.DryRun {
+		data, err := config.marshal()
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write(data)
+
+		return err
+	}
+
+	if err := config.write(path); err != nil {
+		return fmt.Errorf("writing kubeconfig %s: %w", path, err)
+	}
+
+	if updated {
+		fmt.Fprintf(out, "Updated context %s in %s\n", contextName, path)
+	} else {
+		fmt.Fprintf(out, "Added new context %s to %s\n", contextName, path)
+	}
+
+	return nil
+}
+
+// printJSON prints v in the same format as aws-cli's JSON output.
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+
+	return enc.Encode(v)
+}
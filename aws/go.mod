@@ -3,8 +3,16 @@ module github.com/mumoshu/wy/aws
 go 1.16
 
 require (
-	github.com/aws/aws-sdk-go v1.37.1
+	github.com/aws/aws-sdk-go-v2 v1.17.4
+	github.com/aws/aws-sdk-go-v2/config v1.18.12
+	github.com/aws/aws-sdk-go-v2/credentials v1.13.12
+	github.com/aws/aws-sdk-go-v2/service/eks v1.27.2
+	github.com/aws/aws-sdk-go-v2/service/sts v1.18.3
+	github.com/aws/smithy-go v1.13.5
+	github.com/mumoshu/wy/execcredential v0.0.0-00010101000000-000000000000
 	github.com/spf13/cobra v1.1.1
 	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
-	sigs.k8s.io/aws-iam-authenticator v0.5.3
+	gopkg.in/yaml.v2 v2.4.0
 )
+
+replace github.com/mumoshu/wy/execcredential => ../execcredential
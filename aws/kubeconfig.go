@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeconfig is the subset of the kubeconfig file that `aws eks update-kubeconfig` touches.
+// The other fields, including unknown fields of the clusters, users and contexts, are preserved as-is.
+type kubeconfig struct {
+	APIVersion     string                 `yaml:"apiVersion"`
+	Kind           string                 `yaml:"kind"`
+	Clusters       []kubeconfigEntry      `yaml:"clusters"`
+	Contexts       []kubeconfigEntry      `yaml:"contexts"`
+	CurrentContext string                 `yaml:"current-context"`
+	Preferences    map[string]interface{} `yaml:"preferences"`
+	Users          []kubeconfigEntry      `yaml:"users"`
+	Rest           map[string]interface{} `yaml:",inline"`
+}
+
+// kubeconfigEntry is a named cluster, context, or user.
+// Exactly one of Cluster, Context and User is set.
+type kubeconfigEntry struct {
+	Name    string                 `yaml:"name"`
+	Cluster map[string]interface{} `yaml:"cluster,omitempty"`
+	Context map[string]interface{} `yaml:"context,omitempty"`
+	User    map[string]interface{} `yaml:"user,omitempty"`
+}
+
+// defaultKubeconfigPath returns the kubeconfig file that kubectl loads first, like aws-cli does.
+func defaultKubeconfigPath() string {
+	if paths := os.Getenv("KUBECONFIG"); paths != "" {
+		return strings.Split(paths, string(os.PathListSeparator))[0]
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".kube", "config")
+	}
+
+	return filepath.Join(home, ".kube", "config")
+}
+
+// loadKubeconfig loads the kubeconfig file, or returns an empty kubeconfig when the file doesn't exist.
+func loadKubeconfig(path string) (*kubeconfig, error) {
+	c := &kubeconfig{
+		APIVersion:  "v1",
+		Kind:        "Config",
+		Preferences: map[string]interface{}{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// write writes the kubeconfig to the file, creating the parent directory if necessary.
+// The file is readable only by the owner, as it may contain credentials of other clusters.
+func (c *kubeconfig) write(path string) error {
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func (c *kubeconfig) marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// upsert replaces the entry of the same name, or appends it.
+// It returns true when the entry is replaced.
+func upsert(entries []kubeconfigEntry, e kubeconfigEntry) ([]kubeconfigEntry, bool) {
+	for i := range entries {
+		if entries[i].Name == e.Name {
+			entries[i] = e
+			return entries, true
+		}
+	}
+
+	return append(entries, e), false
+}
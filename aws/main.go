@@ -1,85 +1,296 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"time"
 
 	"github.com/mumoshu/wy/aws/pkg/awsclicompat"
+	"github.com/mumoshu/wy/aws/pkg/ekstoken"
+	"github.com/mumoshu/wy/execcredential"
 	"github.com/spf13/cobra"
-	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
 
+// tokenCacheMargin is how long before the expiration a cached token is considered expired,
+// so that the token doesn't expire while client-go is using it.
+const tokenCacheMargin = time.Minute
+
 func main() {
 	cmd := &cobra.Command{
 		Use:   "aws",
-		Short: "partial implementation of aws-cli in Go that has only `eks get-token` sub-command implemented",
+		Short: "partial implementation of aws-cli in Go that has only `eks get-token`, `eks list-clusters`, `eks describe-cluster`, `eks update-kubeconfig` and `sts get-caller-identity` sub-commands implemented",
+		// client-go shows our stderr as-is when the exec credential plugin fails,
+		// so we print a concise error with a hint in main, instead of the usage
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
 
 	eksCmd := &cobra.Command{
 		Use: "eks",
 	}
 
-	var clusterName, roleARN string
+	var (
+		opts     getTokenOptions
+		cacheDir string
+		noCache  bool
+	)
 	getTokenCmd := &cobra.Command{
 		Use: "get-token",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := eksGetToken(os.Stdout, clusterName, roleARN)
+			var cache *awsclicompat.FileCache
+			if !noCache {
+				cache = &awsclicompat.FileCache{Dir: cacheDir}
+			}
+
+			err := eksGetToken(os.Stdout, opts, cache)
 			return err
 		},
 	}
-	getTokenCmd.Flags().StringVar(&clusterName, "cluster-name", "", "Specify the name of the Amazon EKS  cluster to create a token for.")
-	getTokenCmd.Flags().StringVar(&roleARN, "role-arn", "", "Assume this role for credentials when signing the token.")
+	getTokenCmd.Flags().StringVar(&opts.ClusterName, "cluster-name", "", "Specify the name of the Amazon EKS  cluster to create a token for.")
+	getTokenCmd.Flags().StringArrayVar(&opts.RoleARNs, "role-arn", nil, "Assume this role for credentials when signing the token. Specify multiple times to assume the roles in order, e.g. to reach a role in another account.")
+	getTokenCmd.Flags().StringVar(&opts.ExternalID, "external-id", "", "The external ID to pass when assuming the last --role-arn.")
+	getTokenCmd.Flags().StringVar(&opts.SessionName, "session-name", "", "The session name to use when assuming the roles.")
+	getTokenCmd.Flags().DurationVar(&opts.Duration, "duration", 0, "The duration of the assumed role session for the last --role-arn, like 1h. Defaults to that of the role.")
+	getTokenCmd.Flags().StringToStringVar(&opts.Tags, "tag", nil, "The session tag to pass when assuming the last --role-arn, in the form of KEY=VALUE. Specify multiple times to pass multiple tags.")
+	getTokenCmd.Flags().StringVar(&opts.Region, "region", "", "The region to use. Overrides config/env settings.")
+	getTokenCmd.Flags().StringVar(&opts.Profile, "profile", "", "Use a specific profile from your credential file.")
+	getTokenCmd.Flags().StringVar(&cacheDir, "cache-dir", awsclicompat.DefaultCacheDir(), "Directory to cache tokens and the credentials of the assumed roles in until shortly before they expire.")
+	getTokenCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always create a new token and assume the roles without using the cache.")
 
 	eksCmd.AddCommand(getTokenCmd)
+
+	var listClustersOpts eksAPIOptions
+	listClustersCmd := &cobra.Command{
+		Use: "list-clusters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eksListClusters(os.Stdout, listClustersOpts)
+		},
+	}
+	listClustersOpts.addFlags(listClustersCmd)
+
+	eksCmd.AddCommand(listClustersCmd)
+
+	var (
+		describeClusterOpts eksAPIOptions
+		describeClusterName string
+	)
+	describeClusterCmd := &cobra.Command{
+		Use: "describe-cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eksDescribeCluster(os.Stdout, describeClusterOpts, describeClusterName)
+		},
+	}
+	describeClusterOpts.addFlags(describeClusterCmd)
+	describeClusterCmd.Flags().StringVar(&describeClusterName, "name", "", "The name of the cluster to describe.")
+	_ = describeClusterCmd.MarkFlagRequired("name")
+
+	eksCmd.AddCommand(describeClusterCmd)
+
+	var updateKubeconfigOpts updateKubeconfigOptions
+	updateKubeconfigCmd := &cobra.Command{
+		Use: "update-kubeconfig",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eksUpdateKubeconfig(os.Stdout, updateKubeconfigOpts)
+		},
+	}
+	updateKubeconfigOpts.addFlags(updateKubeconfigCmd)
+	updateKubeconfigCmd.Flags().StringVar(&updateKubeconfigOpts.Name, "name", "", "The name of the cluster for which to create a kubeconfig entry.")
+	updateKubeconfigCmd.Flags().StringVar(&updateKubeconfigOpts.Kubeconfig, "kubeconfig", "", "Optionally specify a kubeconfig file to append with your configuration. Defaults to the first file in KUBECONFIG, or ~/.kube/config.")
+	updateKubeconfigCmd.Flags().StringVar(&updateKubeconfigOpts.RoleARN, "role-arn", "", "To assume a role for cluster authentication, specify an IAM role ARN with this option.")
+	updateKubeconfigCmd.Flags().StringVar(&updateKubeconfigOpts.Alias, "alias", "", "Alias for the cluster context name. Defaults to match cluster ARN.")
+	updateKubeconfigCmd.Flags().StringVar(&updateKubeconfigOpts.UserAlias, "user-alias", "", "Alias for the generated user name. Defaults to match cluster ARN.")
+	updateKubeconfigCmd.Flags().BoolVar(&updateKubeconfigOpts.DryRun, "dry-run", false, "Print the merged kubeconfig to stdout instead of writing it to the specified file.")
+	_ = updateKubeconfigCmd.MarkFlagRequired("name")
+
+	eksCmd.AddCommand(updateKubeconfigCmd)
 	cmd.AddCommand(eksCmd)
 
+	stsCmd := &cobra.Command{
+		Use: "sts",
+	}
+
+	var (
+		region, profile string
+		explain         bool
+	)
+	getCallerIdentityCmd := &cobra.Command{
+		Use: "get-caller-identity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stsGetCallerIdentity(os.Stdout, os.Stderr, region, profile, explain)
+		},
+	}
+	getCallerIdentityCmd.Flags().StringVar(&region, "region", "", "The region to use. Overrides config/env settings.")
+	getCallerIdentityCmd.Flags().StringVar(&profile, "profile", "", "Use a specific profile from your credential file.")
+	getCallerIdentityCmd.Flags().BoolVar(&explain, "explain", false, "Print the credential sources configured in the environment and the one in use to stderr.")
+
+	stsCmd.AddCommand(getCallerIdentityCmd)
+	cmd.AddCommand(stsCmd)
+
 	if err := cmd.Execute(); err != nil {
-		log.Fatal(err)
+		execcredential.PrintError(os.Stderr, "aws", err)
+		os.Exit(1)
 	}
 }
 
+// getTokenOptions is the flags of `aws eks get-token`.
+type getTokenOptions struct {
+	ClusterName string
+	// RoleARNs are the roles assumed in order. The last one signs the token
+	RoleARNs    []string
+	ExternalID  string
+	SessionName string
+	Duration    time.Duration
+	Tags        map[string]string
+	Region      string
+	Profile     string
+}
+
+// sessionConfig returns the config of the session that signs the token.
+// ExternalID, Duration and Tags apply only to the last role, as they are usually required by the role in the target account.
+// It fails when any of the options for assuming roles is given without --role-arn, instead of silently ignoring it.
+func (o getTokenOptions) sessionConfig() (*awsclicompat.SessionConfig, error) {
+	conf := &awsclicompat.SessionConfig{
+		Region:  o.Region,
+		Profile: o.Profile,
+	}
+
+	if len(o.RoleARNs) == 0 {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--external-id", o.ExternalID != ""},
+			{"--session-name", o.SessionName != ""},
+			{"--duration", o.Duration != 0},
+			{"--tag", len(o.Tags) > 0},
+		} {
+			if f.set {
+				return nil, fmt.Errorf("%s requires --role-arn", f.name)
+			}
+		}
+
+		return conf, nil
+	}
+
+	last := len(o.RoleARNs) - 1
+
+	for _, arn := range o.RoleARNs[:last] {
+		conf.AssumeRoleChain = append(conf.AssumeRoleChain, awsclicompat.AssumeRoleConfig{
+			RoleARN:     arn,
+			SessionName: o.SessionName,
+		})
+	}
+
+	conf.AssumeRole = &awsclicompat.AssumeRoleConfig{
+		RoleARN:         o.RoleARNs[last],
+		DurationSeconds: int64(o.Duration.Seconds()),
+		ExternalID:      o.ExternalID,
+		SessionName:     o.SessionName,
+		Tags:            o.Tags,
+	}
+
+	return conf, nil
+}
+
 // This replicates the behavior of `aws eks get-token --cluster-name $CLUSTER_NAME`
-// by using aws-iam-authenticator, which is the original implementation of the token generator that is,
+// by reimplementing the token generator of aws-iam-authenticator, which is the original implementation that is,
 // AFAIK, later ported to aws-cli.
 //
 // See https://github.com/aws/aws-cli/blob/develop/awscli/customizations/eks/get_token.py for the aws-cli implementation
 // for reference.
-func eksGetToken(out io.Writer, clusterID, roleARAN string) error {
-	sess := awsclicompat.NewSession("", "")
+//
+// Unlike aws-cli, it caches the token in the cache until tokenCacheMargin before the expiration, so that
+// client-go calling it for every new connection doesn't end up calling STS every time.
+// The credentials of the roles assumed with --role-arn are cached, too, so that a new token is signed without assuming the roles again
+// while the credentials last.
+// The cache is disabled when cache is nil.
+func eksGetToken(out io.Writer, opts getTokenOptions, cache *awsclicompat.FileCache) error {
+	ctx := context.Background()
+
+	var tok ekstoken.Token
 
-	gen, err := token.NewGenerator(true, false)
+	conf, err := opts.sessionConfig()
 	if err != nil {
 		return err
 	}
 
-	tok, err := gen.GetWithRoleForSession(clusterID, roleARAN, sess)
+	optsJSON, err := json.Marshal(opts)
 	if err != nil {
 		return err
 	}
 
-	var execCredential struct {
-		Kind       string            `json:"kind"`
-		APIVersion string            `json:"apiVersion"`
-		Spec       map[string]string `json:"spec"`
-		Status     struct {
-			ExpirationTimestamp string `json:"expirationTimestamp"`
-			Token               string `json:"token"`
-		} `json:"status"`
+	// The credentials and hence the token depend on the environment, too
+	key := awsclicompat.CacheKey("eks-token", string(optsJSON), awsclicompat.CredentialEnv())
+
+	var cached bool
+
+	if cache != nil {
+		var err error
+
+		cached, err = cache.Get(key, tokenCacheMargin, &tok)
+		if err != nil {
+			log.Printf("Ignoring token cache: %v", err)
+		}
 	}
 
-	execCredential.Kind = "ExecCredential"
-	execCredential.APIVersion = "client.authentication.k8s.io/v1alpha1"
-	execCredential.Spec = map[string]string{}
-	execCredential.Status.Token = tok.Token
-	execCredential.Status.ExpirationTimestamp = tok.Expiration.Format(time.RFC3339)
+	if !cached {
+		conf.Cache = cache
+
+		cfg, err := awsclicompat.AWSCredsFromConfig(ctx, conf)
+		if err != nil {
+			return err
+		}
+
+		tok, err = ekstoken.Generate(ctx, cfg, opts.ClusterName)
+		if err != nil {
+			return err
+		}
 
-	enc := json.NewEncoder(out)
-	if err := enc.Encode(execCredential); err != nil {
+		if cache != nil {
+			if err := cache.Put(key, tok.Expiration, tok); err != nil {
+				log.Printf("Unable to cache token: %v", err)
+			}
+		}
+	}
+
+	return execcredential.Print(out, tok.Token, tok.Expiration)
+}
+
+// stsGetCallerIdentity prints the identity whose credentials are in use, like `aws sts get-caller-identity`.
+// It helps debugging which identity `aws eks get-token` uses, e.g. whether IAM Roles for Service Accounts is in effect.
+func stsGetCallerIdentity(out, errOut io.Writer, region, profile string, explain bool) error {
+	if explain {
+		fmt.Fprintln(errOut, "Credential sources in the order of precedence:")
+
+		for _, s := range awsclicompat.CredentialSources(profile) {
+			mark := "-"
+			if s.Configured {
+				mark = "+"
+			}
+
+			fmt.Fprintf(errOut, "  %s %s: %s\n", mark, s.Name, s.Detail)
+		}
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsclicompat.LoadConfig(ctx, region, profile)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	id, err := awsclicompat.GetCallerIdentity(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if explain {
+		fmt.Fprintf(errOut, "Using credentials from %s\n", id.Provider)
+	}
+
+	return printJSON(out, id)
 }
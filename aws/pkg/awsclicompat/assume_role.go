@@ -1,16 +1,25 @@
 package awsclicompat
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"math/rand"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 	"golang.org/x/xerrors"
 )
 
+// credentialsCacheMargin is how long before the expiration the credentials cached in a FileCache are considered expired.
+// It's as long as the presigned URL of an EKS token is valid, so that a token signed with the cached credentials
+// never outlives the credentials.
+const credentialsCacheMargin = 15 * time.Minute
+
 type AssumeRoleConfig struct {
 	RoleARN           string
 	DurationSeconds   int64
@@ -22,70 +31,114 @@ type AssumeRoleConfig struct {
 	TransitiveTagKeys []string
 }
 
-func AssumeRole(sess *session.Session, config AssumeRoleConfig) (*session.Session, *sts.Credentials, error) {
-	var awsDurationSeconds *int64
-
-	if config.DurationSeconds != 0 {
-		awsDurationSeconds = &config.DurationSeconds
-	}
-
-	stsSvc := sts.New(sess)
+// AssumeRole returns the copy of cfg whose credentials are of the assumed role.
+// The credentials are cached in memory, and the role is assumed again with cfg's credentials shortly before they expire.
+//
+// The role is assumed once before returning, so that the error, if any, is returned here instead of on the first API call.
+func AssumeRole(ctx context.Context, cfg aws.Config, config AssumeRoleConfig) (aws.Config, error) {
+	return assumeRole(ctx, cfg, config, nil, "")
+}
 
+// assumeRole is AssumeRole that additionally caches the credentials of the assumed role in the cache for the key
+// until credentialsCacheMargin before they expire, so that other processes assuming the same role don't call STS again.
+// The cache is disabled when cache is nil.
+func assumeRole(ctx context.Context, cfg aws.Config, config AssumeRoleConfig, cache *FileCache, key string) (aws.Config, error) {
 	sessionName := fmt.Sprintf("tf-eksctl-session-%d", rand.Int())
 	if config.SessionName != "" {
 		sessionName = config.SessionName
 	}
 
-	input := &sts.AssumeRoleInput{
-		DurationSeconds: awsDurationSeconds,
-		RoleArn:         aws.String(config.RoleARN),
-		RoleSessionName: aws.String(sessionName),
-	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), config.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
 
-	if config.ExternalID != "" {
-		input.ExternalId = aws.String(config.ExternalID)
-	}
+		if config.DurationSeconds != 0 {
+			o.Duration = time.Duration(config.DurationSeconds) * time.Second
+		}
 
-	if config.Policy != "" {
-		input.Policy = aws.String(config.Policy)
-	}
+		if config.ExternalID != "" {
+			o.ExternalID = aws.String(config.ExternalID)
+		}
+
+		if config.Policy != "" {
+			o.Policy = aws.String(config.Policy)
+		}
 
-	if len(config.PolicyARNs) > 0 {
 		for _, a := range config.PolicyARNs {
-			input.PolicyArns = append(input.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(a)})
+			o.PolicyARNs = append(o.PolicyARNs, types.PolicyDescriptorType{Arn: aws.String(a)})
 		}
-	}
 
-	if len(config.Tags) > 0 {
 		for k, v := range config.Tags {
-			input.Tags = append(input.Tags, &sts.Tag{
+			o.Tags = append(o.Tags, types.Tag{
 				Key:   aws.String(k),
 				Value: aws.String(v),
 			})
 		}
+
+		o.TransitiveTagKeys = config.TransitiveTagKeys
+	})
+
+	var credentials aws.CredentialsProvider = provider
+
+	if cache != nil {
+		credentials = &fileCachedCredentialsProvider{
+			CredentialsProvider: provider,
+			cache:               cache,
+			key:                 key,
+		}
 	}
 
-	if len(config.TransitiveTagKeys) > 0 {
-		input.TransitiveTagKeys = aws.StringSlice(config.TransitiveTagKeys)
+	assumed := cfg.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(credentials)
+
+	if _, err := assumed.Credentials.Retrieve(ctx); err != nil {
+		return aws.Config{}, ClassifyError(xerrors.Errorf("assuming role %s: %w", config.RoleARN, err))
 	}
 
-	assumedRole, err := stsSvc.AssumeRole(input)
+	return assumed, nil
+}
+
+// assumeRoleCacheKey returns the cache key for the credentials of the role assumed with the config,
+// using the source credentials identified by sourceKey.
+func assumeRoleCacheKey(sourceKey string, config AssumeRoleConfig) (string, error) {
+	configJSON, err := json.Marshal(config)
 	if err != nil {
-		return nil, nil, xerrors.Errorf("failed assuming role: %w", err)
+		return "", err
 	}
 
-	newSess, err := session.NewSession(&aws.Config{
-		Credentials: credentials.NewStaticCredentials(
-			*assumedRole.Credentials.AccessKeyId,
-			*assumedRole.Credentials.SecretAccessKey,
-			*assumedRole.Credentials.SessionToken,
-		),
-		Region: sess.Config.Region,
-	})
+	return CacheKey("assume-role", sourceKey, string(configJSON)), nil
+}
+
+// fileCachedCredentialsProvider caches the credentials retrieved by the provider in the FileCache.
+// The credentials that never expire are never cached, as there's no way to tell when they are revoked.
+type fileCachedCredentialsProvider struct {
+	aws.CredentialsProvider
+
+	cache *FileCache
+	key   string
+}
+
+func (p *fileCachedCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	var creds aws.Credentials
 
+	cached, err := p.cache.Get(p.key, credentialsCacheMargin, &creds)
 	if err != nil {
-		return nil, nil, xerrors.Errorf("initializing session with assume role: %w", err)
+		log.Printf("Ignoring credentials cache: %v", err)
+	}
+
+	if cached {
+		return creds, nil
+	}
+
+	creds, err = p.CredentialsProvider.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	if creds.CanExpire {
+		if err := p.cache.Put(p.key, creds.Expires, creds); err != nil {
+			log.Printf("Unable to cache credentials: %v", err)
+		}
 	}
 
-	return newSess, assumedRole.Credentials, nil
+	return creds, nil
 }
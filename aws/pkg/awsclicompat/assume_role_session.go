@@ -1,31 +1,74 @@
 package awsclicompat
 
 import (
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
 type SessionConfig struct {
 	Region     string
 	Profile    string
 	AssumeRole *AssumeRoleConfig
+	// AssumeRoleChain is the roles assumed in order before AssumeRole,
+	// so that you can reach AssumeRole in another account that trusts only the last role in the chain
+	AssumeRoleChain []AssumeRoleConfig
+	// Cache caches the credentials of the assumed roles across processes, keyed by the role, the options to assume it,
+	// and the source credentials, which are the ones of the previous role in the chain, or selected by Region, Profile and CredentialEnv.
+	// The credentials are not cached when Cache is nil
+	Cache *FileCache
 }
 
-func AWSCredsFromConfig(conf *SessionConfig) (*session.Session, *sts.Credentials) {
-	return AWSCredsFromValues(conf.Region, conf.Profile, conf.AssumeRole)
+// AWSCredsFromConfig returns the AWS config whose credentials are of the last role assumed in the chain,
+// or of LoadConfig when no role is configured.
+func AWSCredsFromConfig(ctx context.Context, conf *SessionConfig) (aws.Config, error) {
+	if len(conf.AssumeRoleChain) == 0 && conf.Cache == nil {
+		return AWSCredsFromValues(ctx, conf.Region, conf.Profile, conf.AssumeRole)
+	}
+
+	cfg, err := LoadConfig(ctx, conf.Region, conf.Profile)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	chain := append([]AssumeRoleConfig{}, conf.AssumeRoleChain...)
+	if conf.AssumeRole != nil {
+		chain = append(chain, *conf.AssumeRole)
+	}
+
+	return assumeRoleChain(ctx, cfg, chain, conf.Cache, CacheKey("config", conf.Region, conf.Profile, CredentialEnv()))
 }
 
-func AWSCredsFromValues(region, profile string, assumeRole *AssumeRoleConfig) (*session.Session, *sts.Credentials) {
-	sess := NewSession(region, profile)
+// assumeRoleChain assumes the roles in order, starting with cfg's credentials identified by sourceKey.
+// Each role is the source of the next one, so the cache key of a role covers every role before it.
+func assumeRoleChain(ctx context.Context, cfg aws.Config, chain []AssumeRoleConfig, cache *FileCache, sourceKey string) (aws.Config, error) {
+	for _, c := range chain {
+		key, err := assumeRoleCacheKey(sourceKey, c)
+		if err != nil {
+			return aws.Config{}, err
+		}
 
-	if assumeRole == nil {
-		return sess, nil
+		cfg, err = assumeRole(ctx, cfg, c, cache, key)
+		if err != nil {
+			return aws.Config{}, err
+		}
+
+		sourceKey = key
 	}
 
-	assumed, creds, err := AssumeRole(sess, *assumeRole)
+	return cfg, nil
+}
+
+// AWSCredsFromValues is AWSCredsFromConfig without the role chain.
+func AWSCredsFromValues(ctx context.Context, region, profile string, assumeRole *AssumeRoleConfig) (aws.Config, error) {
+	cfg, err := LoadConfig(ctx, region, profile)
 	if err != nil {
-		panic(err)
+		return aws.Config{}, err
+	}
+
+	if assumeRole == nil {
+		return cfg, nil
 	}
 
-	return assumed, creds
+	return AssumeRole(ctx, cfg, *assumeRole)
 }
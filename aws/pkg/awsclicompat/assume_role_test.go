@@ -0,0 +1,141 @@
+package awsclicompat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAssumeRole returns a fake STS that issues the credentials expiring after the duration for sts:AssumeRole,
+// and the roles assumed so far, in order.
+func fakeAssumeRole(t *testing.T, expiresIn time.Duration) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		assumed []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRole" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		assumed = append(assumed, r.Form.Get("RoleArn")+" "+r.Form.Get("ExternalId"))
+		n := len(assumed)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials><AccessKeyId>ASIA%d</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>%s</Expiration></Credentials><AssumedRoleUser><Arn>%s</Arn><AssumedRoleId>AROA:wy</AssumedRoleId></AssumedRoleUser></AssumeRoleResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></AssumeRoleResponse>`,
+			n, time.Now().Add(expiresIn).UTC().Format(time.RFC3339), r.Form.Get("RoleArn"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string{}, assumed...)
+	}
+}
+
+func TestAssumeRoleChainCache(t *testing.T) {
+	ctx := context.Background()
+
+	chain := []AssumeRoleConfig{
+		{RoleARN: "arn:aws:iam::111111111111:role/hub", SessionName: "wy"},
+		{RoleARN: "arn:aws:iam::222222222222:role/eks", SessionName: "wy", ExternalID: "a"},
+	}
+
+	testcases := []struct {
+		name      string
+		expiresIn time.Duration
+		// second is the chain assumed after the chain above
+		second []AssumeRoleConfig
+		// want is the roles assumed via STS for the both chains
+		want []string
+	}{
+		{
+			name:      "same chain",
+			expiresIn: time.Hour,
+			second:    chain,
+			want:      []string{"arn:aws:iam::111111111111:role/hub ", "arn:aws:iam::222222222222:role/eks a"},
+		},
+		{
+			name:      "different external ID of the last role",
+			expiresIn: time.Hour,
+			second:    []AssumeRoleConfig{chain[0], {RoleARN: "arn:aws:iam::222222222222:role/eks", SessionName: "wy", ExternalID: "b"}},
+			want:      []string{"arn:aws:iam::111111111111:role/hub ", "arn:aws:iam::222222222222:role/eks a", "arn:aws:iam::222222222222:role/eks b"},
+		},
+		{
+			name:      "last role alone from the same source",
+			expiresIn: time.Hour,
+			second:    chain[1:],
+			want:      []string{"arn:aws:iam::111111111111:role/hub ", "arn:aws:iam::222222222222:role/eks a", "arn:aws:iam::222222222222:role/eks a"},
+		},
+		{
+			name:      "credentials expiring before a token signed with them",
+			expiresIn: 10 * time.Minute,
+			second:    chain,
+			want:      []string{"arn:aws:iam::111111111111:role/hub ", "arn:aws:iam::222222222222:role/eks a", "arn:aws:iam::111111111111:role/hub ", "arn:aws:iam::222222222222:role/eks a"},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			srv, assumed := fakeAssumeRole(t, tc.expiresIn)
+			cache := &FileCache{Dir: t.TempDir()}
+
+			first, err := assumeRoleChain(ctx, stsConfig(srv.URL), chain, cache, "source")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second, err := assumeRoleChain(ctx, stsConfig(srv.URL), tc.second, cache, "source")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := assumed(); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("unexpected roles assumed: want %q, got %q", tc.want, got)
+			}
+
+			a, err := first.Credentials.Retrieve(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := second.Credentials.Retrieve(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reused := len(tc.want) == len(chain); reused != (a.AccessKeyID == b.AccessKeyID) {
+				t.Errorf("unexpected credentials: first %s, second %s", a.AccessKeyID, b.AccessKeyID)
+			}
+		})
+	}
+
+	t.Run("no cache", func(t *testing.T) {
+		srv, assumed := fakeAssumeRole(t, time.Hour)
+
+		for i := 0; i < 2; i++ {
+			if _, err := assumeRoleChain(ctx, stsConfig(srv.URL), chain, nil, "source"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := assumed(); len(got) != 4 {
+			t.Errorf("unexpected roles assumed: %q", got)
+		}
+	})
+}
@@ -1,44 +1,151 @@
 package awsclicompat
 
 import (
+	"context"
+	"errors"
 	"os"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"golang.org/x/xerrors"
 )
 
-// NewSession creates a new AWS session for the given AWS region.
+// defaultRegion is the region used when no region is configured, so that STS calls and EKS tokens work without AWS_REGION,
+// the same as aws-iam-authenticator that used the global STS endpoint in us-east-1.
+const defaultRegion = "us-east-1"
+
+// LoadConfig loads the AWS config for the given AWS region and profile, the same way as aws-cli does.
 //
 // The following credential sources are supported:
 //
 // 1. static credentials (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY)
-// 2. static credentials loaded from profiles (AWS_PROFILE, when AWS_SDK_LOAD_CONFIG=true)
-// 3. dynamic credentials obtained by assuming the role using static credentials loaded from the profile (AWS_PROFILE, when AWS_SDK_LOAD_CONFIG=true)
+// 2. static credentials loaded from profiles (AWS_PROFILE)
+// 3. dynamic credentials obtained by assuming the role using static credentials loaded from the profile (AWS_PROFILE)
 // 4. dynamic credentials obtained by assuming the role using static credentials loaded from the env (FORCE_AWS_PROFILE=true w/ credential_source=Environment)
+// 5. web identity credentials obtained by assuming the role with the OIDC token (AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, set by IAM Roles for Service Accounts on EKS)
+// 6. container credentials (AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI, set by ECS and EKS Pod Identity)
+// 7. EC2 instance role credentials from the instance metadata service, using IMDSv2 when available
+// 8. AWS SSO credentials of the profile with sso_start_url or sso_session, using the SSO token cached by `aws sso login`
+//
+// See CredentialSources for how each source is configured in the current environment.
+//
+// The credentials are cached in memory and refreshed shortly before they expire.
+// The error is one of NoCredentialsError, AccessDeniedError, NetworkError, and SSOLoginRequiredError when it's caused by them.
 //
 // The fourth option of using FORCE_AWS_PROFILE=true and AWS_PROFILE=yourprofile is equivalent to `aws --profile ${AWS_PROFILE}`.
 // See https://github.com/variantdev/vals/issues/19#issuecomment-600437486 for more details and why and when this is needed.
-func NewSession(region, profile string) *session.Session {
-	var cfg *aws.Config
-	if region != "" {
-		cfg = aws.NewConfig().WithRegion(region)
-	} else {
-		cfg = aws.NewConfig()
+func LoadConfig(ctx context.Context, region, profile string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithDefaultRegion(defaultRegion),
+		config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}),
 	}
 
-	opts := session.Options{
-		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
-		SharedConfigState:       session.SharedConfigEnable,
-		Config:                  *cfg,
-		Profile:                 profile,
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
 	}
 
 	if os.Getenv("FORCE_AWS_PROFILE") == "true" {
-		opts.Profile = os.Getenv("AWS_PROFILE")
+		profile = os.Getenv("AWS_PROFILE")
 	}
 
-	sess := session.Must(session.NewSessionWithOptions(opts))
+	// Unlike AWS_PROFILE, the profile set here takes precedence over AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY,
+	// which is what FORCE_AWS_PROFILE relies on
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, ClassifyError(xerrors.Errorf("loading AWS config: %w", err))
+	}
+
+	// AWS_ACCESS_KEY_ID and AWS_WEB_IDENTITY_TOKEN_FILE take precedence over the profile set via AWS_PROFILE
+	profileUsed := profile != "" || (os.Getenv("AWS_ACCESS_KEY_ID") == "" && os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") == "")
+
+	if name := profileName(profile); profileUsed && usesSSO(ctx, name) {
+		cfg.Credentials = &ssoCredentialsProvider{CredentialsProvider: cfg.Credentials, profile: name}
+	}
+
+	return cfg, nil
+}
+
+// profileName returns the name of the profile LoadConfig loads the shared config from.
+func profileName(profile string) string {
+	if profile != "" {
+		return profile
+	}
+
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+
+	return config.DefaultSharedConfigProfile
+}
+
+// sharedConfigFiles returns the shared credentials and config files that LoadConfig reads,
+// which are overridden by AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE.
+func sharedConfigFiles() (string, string) {
+	credentialsFile, configFile := config.DefaultSharedCredentialsFilename(), config.DefaultSharedConfigFilename()
+
+	if f := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); f != "" {
+		credentialsFile = f
+	}
+
+	if f := os.Getenv("AWS_CONFIG_FILE"); f != "" {
+		configFile = f
+	}
+
+	return credentialsFile, configFile
+}
+
+// loadSharedConfigProfile loads the profile from the same files as LoadConfig does.
+// Unlike LoadConfig, config.LoadSharedConfigProfile reads the default files regardless of AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE.
+func loadSharedConfigProfile(ctx context.Context, profile string) (config.SharedConfig, error) {
+	credentialsFile, configFile := sharedConfigFiles()
+
+	return config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		o.CredentialsFiles = []string{credentialsFile}
+		o.ConfigFiles = []string{configFile}
+	})
+}
+
+// usesSSO returns true when the profile gets credentials from AWS SSO.
+func usesSSO(ctx context.Context, profile string) bool {
+	sc, err := loadSharedConfigProfile(ctx, profile)
+	if err != nil {
+		return false
+	}
+
+	return sc.SSOStartURL != "" || sc.SSOSessionName != ""
+}
+
+// ssoCredentialsProvider turns the errors caused by the missing or expired SSO token into SSOLoginRequiredError,
+// as the SDK doesn't tell them apart from other errors.
+type ssoCredentialsProvider struct {
+	aws.CredentialsProvider
+	profile string
+}
+
+func (p *ssoCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if err == nil {
+		return creds, nil
+	}
+
+	classified := ClassifyError(err)
+
+	var (
+		networkErr *NetworkError
+		deniedErr  *AccessDeniedError
+	)
+
+	// The SSO portal may be unreachable, or the SSO user may not be allowed to use the role
+	if errors.As(classified, &networkErr) || errors.As(classified, &deniedErr) {
+		return creds, classified
+	}
 
-	return sess
+	return creds, &SSOLoginRequiredError{Profile: p.profile, Err: err}
 }
@@ -0,0 +1,157 @@
+package awsclicompat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// FileCache caches JSON-encoded values in files under Dir, until they expire.
+//
+// It's safe for concurrent use, including by multiple processes sharing the same Dir,
+// as every write atomically replaces the file by renaming a temporary file.
+// The worst case of concurrent writes is that each process calls AWS once and the last write wins.
+type FileCache struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+type fileCacheEntry struct {
+	Expiration time.Time       `json:"expiration"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// DefaultCacheDir returns the directory wy caches EKS tokens and the credentials of the assumed roles in by default.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "wy", "aws")
+}
+
+// CacheKey returns the key for the values that are identified by the parts.
+func CacheKey(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+
+	return hex.EncodeToString(h[:])
+}
+
+// credentialEnvVars are the environment variables that select the credentials, the identity behind them, or the region the token is signed for.
+var credentialEnvVars = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"FORCE_AWS_PROFILE",
+	"AWS_CONFIG_FILE",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_ROLE_ARN",
+	"AWS_ROLE_SESSION_NAME",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_EC2_METADATA_DISABLED",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+}
+
+// CredentialEnv returns the values of the environment variables that affect the credentials,
+// to be included in the cache key so that a value cached for one identity is never returned for another.
+// The values are hashed by CacheKey, so the secrets never end up in the cache file names.
+func CredentialEnv() string {
+	var parts []string
+
+	for _, name := range credentialEnvVars {
+		parts = append(parts, name+"="+os.Getenv(name))
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// Get decodes the value cached for the key into v.
+// It returns false when there's no value cached, or the value expires within the margin.
+func (c *FileCache) Get(key string, margin time.Duration, v interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := ioutil.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, xerrors.Errorf("reading cache: %w", err)
+	}
+
+	var e fileCacheEntry
+
+	// A corrupted cache file is treated as a cache miss and is overwritten by the next Put
+	if err := json.Unmarshal(data, &e); err != nil {
+		return false, nil
+	}
+
+	if time.Now().Add(margin).After(e.Expiration) {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Put caches the value for the key until the expiration.
+func (c *FileCache) Put(key string, expiration time.Time, v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(fileCacheEntry{Expiration: expiration, Value: value})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return xerrors.Errorf("creating cache dir: %w", err)
+	}
+
+	f, err := ioutil.TempFile(c.Dir, key+".*.tmp")
+	if err != nil {
+		return xerrors.Errorf("writing cache: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return xerrors.Errorf("writing cache: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return xerrors.Errorf("writing cache: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		return xerrors.Errorf("writing cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
@@ -0,0 +1,119 @@
+package awsclicompat
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/xerrors"
+)
+
+// CredentialSource describes a source of AWS credentials and whether it's configured in the environment.
+// Sources are listed in the order the SDK tries them.
+type CredentialSource struct {
+	Name string `json:"name"`
+	// Configured is true when the environment has what the source requires.
+	// It doesn't mean that the credentials from the source are valid.
+	Configured bool   `json:"configured"`
+	Detail     string `json:"detail"`
+}
+
+// CredentialSources returns the credential sources that LoadConfig may load credentials from, and how they're configured.
+// It never includes the credentials themselves, so that the result can be safely printed.
+func CredentialSources(profile string) []CredentialSource {
+	var sources []CredentialSource
+
+	add := func(name string, configured bool, format string, args ...interface{}) {
+		sources = append(sources, CredentialSource{Name: name, Configured: configured, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
+		add("env", true, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are set")
+	} else {
+		add("env", false, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+
+	credentialsFile, configFile := sharedConfigFiles()
+
+	if profile != "" {
+		add("profile", true, "profile %s in %s and %s", profile, credentialsFile, configFile)
+	} else {
+		add("profile", false, "the default profile in %s and %s, if any", credentialsFile, configFile)
+	}
+
+	if sc, err := loadSharedConfigProfile(context.TODO(), profileName(profile)); err != nil {
+		add("sso", false, "profile %s is not found", profileName(profile))
+	} else if sc.SSOSessionName != "" {
+		add("sso", true, "profile %s uses the sso-session %s. Run `aws sso login --profile %s` when the SSO token is expired", sc.Profile, sc.SSOSessionName, sc.Profile)
+	} else if sc.SSOStartURL != "" {
+		add("sso", true, "profile %s uses AWS SSO at %s. Run `aws sso login --profile %s` when the SSO token is expired", sc.Profile, sc.SSOStartURL, sc.Profile)
+	} else {
+		add("sso", false, "profile %s doesn't use AWS SSO", sc.Profile)
+	}
+
+	tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+
+	switch {
+	case tokenFile == "" && roleARN == "":
+		add("web-identity", false, "AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN are not set. Annotate the service account with eks.amazonaws.com/role-arn to use IAM Roles for Service Accounts")
+	case tokenFile == "" || roleARN == "":
+		add("web-identity", false, "both AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN must be set, but only one of them is set")
+	default:
+		if _, err := os.Stat(tokenFile); err != nil {
+			add("web-identity", false, "role %s with the token file %s, which is unreadable: %v", roleARN, tokenFile, err)
+		} else {
+			add("web-identity", true, "role %s with the token file %s", roleARN, tokenFile)
+		}
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		add("container", true, "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI is %s", uri)
+	} else if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		add("container", true, "AWS_CONTAINER_CREDENTIALS_FULL_URI is %s", uri)
+	} else {
+		add("container", false, "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI and AWS_CONTAINER_CREDENTIALS_FULL_URI are not set")
+	}
+
+	if os.Getenv("AWS_EC2_METADATA_DISABLED") == "true" {
+		add("imds", false, "AWS_EC2_METADATA_DISABLED is true")
+	} else {
+		add("imds", true, "the EC2 instance metadata service, with IMDSv2 when available. In a pod, the instance's hop limit must be 2 or more for IMDSv2")
+	}
+
+	return sources
+}
+
+// CallerIdentity is the identity whose credentials are used to call AWS APIs, like `aws sts get-caller-identity` prints.
+type CallerIdentity struct {
+	UserId  string
+	Account string
+	Arn     string
+	// Provider is the name of the credentials provider that provided the credentials, like WebIdentityCredentials
+	Provider string `json:"-"`
+}
+
+// GetCallerIdentity returns the identity of the config's credentials.
+func GetCallerIdentity(ctx context.Context, cfg aws.Config) (*CallerIdentity, error) {
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, ClassifyError(xerrors.Errorf("retrieving credentials: %w", err))
+	}
+
+	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, ClassifyError(xerrors.Errorf("calling sts:GetCallerIdentity with credentials from %s: %w", creds.Source, err))
+	}
+
+	return &CallerIdentity{
+		UserId:   aws.ToString(out.UserId),
+		Account:  aws.ToString(out.Account),
+		Arn:      aws.ToString(out.Arn),
+		Provider: creds.Source,
+	}, nil
+}
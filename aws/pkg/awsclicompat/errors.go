@@ -0,0 +1,165 @@
+package awsclicompat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// NoCredentialsError is returned when no credential source provided credentials,
+// e.g. when neither IAM Roles for Service Accounts nor AWS_ACCESS_KEY_ID is configured in the pod.
+type NoCredentialsError struct {
+	Err error
+}
+
+func (e *NoCredentialsError) Error() string {
+	return "no AWS credentials found: " + e.Err.Error()
+}
+
+func (e *NoCredentialsError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NoCredentialsError) Hint() string {
+	return "Annotate the service account of the pod with eks.amazonaws.com/role-arn to use IAM Roles for Service Accounts, " +
+		"set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or set AWS_PROFILE to an existing profile, including the one that uses AWS SSO. " +
+		"Run `aws sts get-caller-identity --explain` to see the credential sources configured in the environment"
+}
+
+// AccessDeniedError is returned when AWS rejected the credentials,
+// or the identity is not allowed to do the operation like assuming the role.
+type AccessDeniedError struct {
+	Err error
+}
+
+func (e *AccessDeniedError) Error() string {
+	return "access denied by AWS: " + e.Err.Error()
+}
+
+func (e *AccessDeniedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AccessDeniedError) Hint() string {
+	return "Run `aws sts get-caller-identity` to see the identity in use. " +
+		"Ensure that the credentials are not expired, the identity is allowed to sts:AssumeRole the --role-arn, " +
+		"and the trust policy of the role trusts the identity, with the --external-id if it requires one"
+}
+
+// NetworkError is returned when AWS was unreachable.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "unable to reach AWS: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NetworkError) Hint() string {
+	return "Ensure that the pod can reach the AWS API endpoints of the region like STS and EKS, via HTTPS_PROXY if required, " +
+		"and that the region set via --region or AWS_REGION is correct"
+}
+
+// SSOLoginRequiredError is returned when the profile uses AWS SSO, but the SSO token cached by `aws sso login` is missing or expired.
+type SSOLoginRequiredError struct {
+	// Profile is the profile that uses AWS SSO. It's empty when unknown
+	Profile string
+	Err     error
+}
+
+func (e *SSOLoginRequiredError) Error() string {
+	return "AWS SSO login required: " + e.Err.Error()
+}
+
+func (e *SSOLoginRequiredError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SSOLoginRequiredError) Hint() string {
+	if e.Profile == "" {
+		return "Run `aws sso login` with aws-cli v2 for the profile in use, so that the SSO token is cached in ~/.aws/sso/cache"
+	}
+
+	return fmt.Sprintf("Run `aws sso login --profile %s` with aws-cli v2, so that the SSO token is cached in ~/.aws/sso/cache", e.Profile)
+}
+
+// Hint returns the remediation hint for the error, or an empty string when there's none.
+func Hint(err error) string {
+	var h interface{ Hint() string }
+
+	if errors.As(err, &h) {
+		return h.Hint()
+	}
+
+	return ""
+}
+
+// accessDeniedCodes are the error codes of AWS APIs that mean the credentials are rejected or not allowed to do the operation
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"InvalidClientTokenId":        true,
+	"SignatureDoesNotMatch":       true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"UnrecognizedClientException": true,
+	"InvalidIdentityToken":        true,
+	"UnauthorizedException":       true,
+	"ForbiddenException":          true,
+}
+
+// ClassifyError wraps the error returned by aws-sdk-go-v2 into NoCredentialsError, AccessDeniedError, NetworkError, or SSOLoginRequiredError
+// depending on the cause, so that the caller can tell what went wrong with errors.As and print the Hint.
+// Other errors, including the ones already classified, are returned as-is.
+func ClassifyError(err error) error {
+	if err == nil || Hint(err) != "" {
+		return err
+	}
+
+	var (
+		apiErr          smithy.APIError
+		profileErr      config.SharedConfigProfileNotExistError
+		invalidTokenErr *ssocreds.InvalidTokenError
+		sendErr         *smithyhttp.RequestSendError
+		opErr           *net.OpError
+		dnsErr          *net.DNSError
+	)
+
+	switch {
+	case errors.As(err, &apiErr) && accessDeniedCodes[apiErr.ErrorCode()]:
+		return &AccessDeniedError{Err: err}
+	case errors.As(err, &invalidTokenErr):
+		return &SSOLoginRequiredError{Err: err}
+	case errors.As(err, &profileErr):
+		return &NoCredentialsError{Err: err}
+	case failedIn(err, "ec2imds"):
+		// The SDK falls back to the EC2 instance role when no other credential source is configured.
+		// The instance metadata service that is unreachable or has no role means the absence of credentials, rather than a network error.
+		return &NoCredentialsError{Err: err}
+	case errors.As(err, &sendErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return &NetworkError{Err: err}
+	}
+
+	return err
+}
+
+// failedIn returns true when the error is caused by an operation of the service.
+// Unlike errors.As, it checks all the operation errors in the chain, as an operation of a service may call another service.
+func failedIn(err error, service string) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if opErr, ok := err.(*smithy.OperationError); ok && opErr.Service() == service {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+// Package ekstoken generates EKS authentication tokens in-process,
+// the same way as `aws eks get-token` does, so that Kubernetes clients don't need to exec the aws command.
+package ekstoken
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/mumoshu/wy/aws/pkg/awsclicompat"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// refreshMargin is how long before the expiration a token is regenerated,
+	// so that the token doesn't expire while a request is in flight.
+	refreshMargin = time.Minute
+
+	// clusterIDHeader is the signed header that binds the token to the cluster
+	clusterIDHeader = "x-k8s-aws-id"
+
+	// presignedURLExpiration is how long EKS accepts the token for,
+	// regardless of X-Amz-Expires of the presigned URL
+	presignedURLExpiration = 15 * time.Minute
+
+	v1Prefix = "k8s-aws-v1."
+)
+
+// Token is an EKS authentication token.
+// It's encoded the same as the token of aws-iam-authenticator, so that the tokens cached by the older versions of wy remain usable.
+type Token struct {
+	Token      string
+	Expiration time.Time
+}
+
+// Generate generates a token for the cluster, signed with the credentials of cfg.
+//
+// The token is the presigned URL of sts:GetCallerIdentity with the cluster name in the signed header,
+// which EKS calls to authenticate the caller.
+// See https://github.com/kubernetes-sigs/aws-iam-authenticator#api-authorization-from-outside-a-cluster for details.
+func Generate(ctx context.Context, cfg aws.Config, clusterName string) (Token, error) {
+	client := sts.NewPresignClient(sts.NewFromConfig(cfg))
+
+	req, err := client.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(o *sts.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions,
+				smithyhttp.SetHeaderValue(clusterIDHeader, clusterName),
+				// The signer moves X-Amz-* headers into the query of the presigned URL
+				smithyhttp.SetHeaderValue("X-Amz-Expires", "60"),
+			)
+		})
+	})
+	if err != nil {
+		return Token{}, awsclicompat.ClassifyError(xerrors.Errorf("presigning sts:GetCallerIdentity: %w", err))
+	}
+
+	// Expire the token a minute earlier than EKS does, so that clients don't use a token that is about to expire
+	expiration := time.Now().Local().Add(presignedURLExpiration - time.Minute)
+
+	return Token{
+		Token:      v1Prefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL)),
+		Expiration: expiration,
+	}, nil
+}
+
+// TokenSource generates and caches EKS tokens for a cluster.
+// It's safe for concurrent use.
+type TokenSource struct {
+	ClusterName string
+	// RoleARN is the optional IAM role to assume for signing the token
+	RoleARN string
+	// Profile is the optional AWS profile to load credentials from
+	Profile string
+
+	mu  sync.Mutex
+	cfg *aws.Config
+	tok *Token
+}
+
+// Token returns the cached token, or generates a new one when the cached one expires within refreshMargin.
+// See awsclicompat.ClassifyError for the errors it may return.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok != nil && time.Now().Add(refreshMargin).Before(s.tok.Expiration) {
+		return s.tok.Token, nil
+	}
+
+	// The config is reused across tokens, so that the credentials, including those of the assumed role, are cached until they expire
+	if s.cfg == nil {
+		var assumeRole *awsclicompat.AssumeRoleConfig
+		if s.RoleARN != "" {
+			assumeRole = &awsclicompat.AssumeRoleConfig{RoleARN: s.RoleARN}
+		}
+
+		cfg, err := awsclicompat.AWSCredsFromValues(ctx, "", s.Profile, assumeRole)
+		if err != nil {
+			return "", err
+		}
+
+		s.cfg = &cfg
+	}
+
+	tok, err := Generate(ctx, *s.cfg, s.ClusterName)
+	if err != nil {
+		return "", err
+	}
+
+	s.tok = &tok
+
+	return tok.Token, nil
+}
+
+// WrapTransport returns a round tripper that authenticates every request with the token.
+// It's intended to be used as rest.Config.WrapTransport.
+func (s *TokenSource) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &roundTripper{source: s, base: rt}
+}
+
+type roundTripper struct {
+	source *TokenSource
+	base   http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := rt.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+tok)
+
+	return rt.base.RoundTrip(r)
+}
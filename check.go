@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func check(args []string) error {
+	if len(args) == 0 || args[0] != "cluster" {
+		return fmt.Errorf("the only supported check sub-command is \"cluster\", but you provided %v", args)
+	}
+
+	args = args[1:]
+
+	var (
+		argocdCluster  argocdClusterFlags
+		kubeconfigPath string
+		argocdServer   argocdServerFlags
+	)
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-check-cluster", appName), flag.ExitOnError)
+	argocdCluster.register(fs)
+	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for accessing the ArgoCD cluster secrets")
+	argocdServer.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if argocdCluster.isZero() {
+		return fmt.Errorf("missing value for the required flag %s, %s or %s", "-argocd-cluster-secret", "-argocd-cluster", "-argocd-cluster-selector")
+	}
+
+	cluster, err := checkClusterViaAPIServer(argocdServer, argocdCluster)
+	if err != nil {
+		return err
+	}
+
+	argocdReported := cluster != nil
+
+	if cluster == nil {
+		c, err := getCluster(kubeconfigPath, argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		cluster = c.Cluster
+
+		// We use the same rest config as ArgoCD so that
+		// we can see how the ArgoCD application controller would see the cluster.
+		clusterRestConfig, err := c.restConfig(argocdCluster.awsAuth)
+		if err != nil {
+			now := metav1.Now()
+			cluster.Info.ConnectionState = argocd.ConnectionState{
+				Status:     argocd.ConnectionStatusUnknown,
+				Message:    err.Error(),
+				ModifiedAt: &now,
+			}
+		} else {
+			cluster.CheckConnection(clusterRestConfig)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	// We intentionally print only the info to avoid leaking credentials in the cluster config
+	if err := enc.Encode(clusterCheckResult{
+		Name:           cluster.Name,
+		Server:         cluster.Server,
+		ArgoCDReported: argocdReported,
+		Info:           cluster.Info,
+	}); err != nil {
+		return err
+	}
+
+	if s := cluster.Info.ConnectionState.Status; s != argocd.ConnectionStatusSuccessful {
+		if argocdReported {
+			return fmt.Errorf("connection to cluster %s reported by ArgoCD: %s", cluster.Server, s)
+		}
+
+		return fmt.Errorf("connection to cluster %s: %s", cluster.Server, s)
+	}
+
+	return nil
+}
+
+// checkClusterViaAPIServer returns the cluster selected by the flags, fetched from the ArgoCD API server.
+// The cluster info is the one populated by ArgoCD, as the API server redacts the credentials we need to connect to the cluster.
+// It returns nil without an error when -argocd-server is not set, the cluster is selected by the secret name,
+// or the clusters are read from a source other than the cluster secrets, which may contain clusters unknown to ArgoCD.
+// It also returns nil without an error when the API server is unavailable, so that the caller falls back to the cluster secrets.
+// Unlike the API server errors, the errors selecting the cluster, like when the flags matched more than one cluster, are returned as is.
+func checkClusterViaAPIServer(argocdServer argocdServerFlags, argocdCluster argocdClusterFlags) (*argocd.Cluster, error) {
+	if argocdServer.server == "" || argocdCluster.secret != "" || !argocdCluster.isSecretSource() {
+		return nil, nil
+	}
+
+	clusters, err := listClustersFromAPIServer(argocdServer)
+	if err != nil {
+		log.Printf("Unable to fetch the cluster from the ArgoCD API server %s: %v. Falling back to the cluster secrets", argocdServer.server, err)
+		return nil, nil
+	}
+
+	c, err := selectOneCluster(clusters, argocdCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Cluster, nil
+}
+
+// clusterCheckResult is the result of `check cluster`.
+// It must never contain credentials.
+type clusterCheckResult struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+	// ArgoCDReported is true when Info is the one ArgoCD reported via -argocd-server,
+	// which wy didn't check by connecting to the cluster.
+	ArgoCDReported bool               `json:"argocdReported,omitempty"`
+	Info           argocd.ClusterInfo `json:"info"`
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckClusterViaAPIServer(t *testing.T) {
+	clusters := `{"items":[
+		{"name":"prod-east","server":"https://east.example.com","labels":{"env":"prod"},"info":{"connectionState":{"status":"Successful"}}},
+		{"name":"prod-west","server":"https://west.example.com","labels":{"env":"prod"},"info":{"connectionState":{"status":"Failed"}}}
+	]}`
+
+	testcases := []struct {
+		name       string
+		status     int
+		cluster    argocdClusterFlags
+		wantServer string
+		wantErr    string
+	}{
+		{
+			name:       "one cluster matched",
+			status:     http.StatusOK,
+			cluster:    argocdClusterFlags{cluster: "name=prod-west"},
+			wantServer: "https://west.example.com",
+		},
+		{
+			name:    "more than one cluster matched",
+			status:  http.StatusOK,
+			cluster: argocdClusterFlags{selector: "env=prod"},
+			wantErr: "matched more than one ArgoCD cluster",
+		},
+		{
+			name:    "no cluster matched",
+			status:  http.StatusOK,
+			cluster: argocdClusterFlags{selector: "env=staging", namespace: "argocd"},
+			wantErr: "no ArgoCD clusters in namespace argocd matched",
+		},
+		{
+			name:    "API server unavailable",
+			status:  http.StatusServiceUnavailable,
+			cluster: argocdClusterFlags{selector: "env=prod"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				if tc.status == http.StatusOK {
+					w.Write([]byte(clusters))
+				}
+			}))
+			defer srv.Close()
+
+			cluster, err := checkClusterViaAPIServer(argocdServerFlags{server: srv.URL}, tc.cluster)
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.wantServer == "" {
+				if cluster != nil {
+					t.Errorf("expected nil to fall back to the cluster secrets, got %+v", cluster)
+				}
+
+				return
+			}
+
+			if cluster == nil || cluster.Server != tc.wantServer {
+				t.Errorf("unexpected cluster: %+v", cluster)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// argocdClusterFlags holds the flags that select the target cluster out of the clusters registered to ArgoCD.
+type argocdClusterFlags struct {
+	// secret is the name of the cluster secret, in the form of NAME or NAMESPACE/NAME,
+	// or the name of the cluster in the source when source is other than the ArgoCD cluster secrets
+	secret string
+	// cluster is either name=NAME or server=URL that is matched against the cluster's Name or Server
+	cluster string
+	// selector is a label selector that is matched against the cluster's Labels
+	selector string
+	// namespace is where the cluster secrets are looked up when selecting by cluster or selector,
+	// and the namespace of the secret given as NAME. See secretNamespacedName
+	namespace string
+	// source is where the clusters are read from, like argocd-secrets or vault:secret/clusters. See newClusterSource
+	source string
+	// awsAuth is how to authenticate to EKS clusters with awsAuthConfig. Either awsAuthExec or awsAuthInProcess
+	awsAuth string
+}
+
+// The ways to authenticate to EKS clusters, that are selected with the -aws-auth flag.
+const (
+	awsAuthExec      = "exec"
+	awsAuthInProcess = "in-process"
+)
+
+func (f *argocdClusterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.secret, "argocd-cluster-secret", "", "Name of the Kubernetes secret that contains an ArgoCD-style cluster connection info, in the form of NAME or NAMESPACE/NAME. With -cluster-source other than argocd-secrets, the name of the cluster in the source")
+	fs.StringVar(&f.source, "cluster-source", clusterSourceSecrets, clusterSourceUsage)
+	fs.StringVar(&f.cluster, "argocd-cluster", "", "The ArgoCD cluster to connect to, in the form of name=NAME or server=URL. Can be used instead of -argocd-cluster-secret")
+	fs.StringVar(&f.selector, "argocd-cluster-selector", "", "Label selector of the ArgoCD cluster to connect to, like env=staging. Can be used instead of -argocd-cluster-secret")
+	fs.StringVar(&f.namespace, "argocd-namespace", "default", "Namespace of the ArgoCD cluster secrets to look up for -argocd-cluster and -argocd-cluster-selector, and of -argocd-cluster-secret given as NAME")
+	fs.StringVar(&f.awsAuth, "aws-auth", awsAuthExec, "How to authenticate to EKS clusters with awsAuthConfig. exec runs `aws eks get-token` like ArgoCD does, and in-process generates the token without the aws command. Generated kubeconfigs always use exec")
+}
+
+// registerDeprecatedAlias registers the old name of the flag that sets the same value as the flag of the new name,
+// so that the commands that used to have their own flag names keep accepting them.
+func registerDeprecatedAlias(fs *flag.FlagSet, old, new string) {
+	fs.Var(fs.Lookup(new).Value, old, fmt.Sprintf("Deprecated. Use -%s instead", new))
+}
+
+// isZero returns true when no ArgoCD cluster is selected, that is when the cluster in the kubeconfig is the target.
+func (f argocdClusterFlags) isZero() bool {
+	return f.secret == "" && f.cluster == "" && f.selector == ""
+}
+
+// secretNamespacedName returns the namespace and the name of the cluster secret given by -argocd-cluster-secret.
+// The namespace defaults to -argocd-namespace when the secret is given as NAME, so that every command resolves the same secret.
+func (f argocdClusterFlags) secretNamespacedName() (string, string) {
+	namespace := f.namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	return splitNamespacedName(f.secret, namespace)
+}
+
+// isSecretSource returns true when the clusters are read from the ArgoCD cluster secrets.
+func (f argocdClusterFlags) isSecretSource() bool {
+	return f.source == "" || f.source == clusterSourceSecrets
+}
+
+// where returns the description of where the clusters are looked up, for error messages.
+func (f argocdClusterFlags) where() string {
+	if f.isSecretSource() {
+		return "namespace " + f.namespace
+	}
+
+	return f.source
+}
+
+func (f argocdClusterFlags) String() string {
+	switch {
+	case f.secret != "":
+		return "secret " + f.secret
+	case f.cluster != "":
+		return f.cluster
+	default:
+		return "selector " + f.selector
+	}
+}
+
+// match returns a function that returns true when the cluster is selected by -argocd-cluster and -argocd-cluster-selector.
+func (f argocdClusterFlags) match() (func(*argocd.Cluster) bool, error) {
+	var matchers []func(*argocd.Cluster) bool
+
+	if f.cluster != "" {
+		kv := strings.SplitN(f.cluster, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid value for -argocd-cluster: %q. It must be in the form of name=NAME or server=URL", f.cluster)
+		}
+
+		v := kv[1]
+
+		switch kv[0] {
+		case "name":
+			matchers = append(matchers, func(c *argocd.Cluster) bool {
+				return c.Name == v
+			})
+		case "server":
+			v = strings.TrimRight(v, "/")
+			matchers = append(matchers, func(c *argocd.Cluster) bool {
+				return c.Server == v
+			})
+		default:
+			return nil, fmt.Errorf("invalid value for -argocd-cluster: %q. The key must be either name or server", f.cluster)
+		}
+	}
+
+	if f.selector != "" {
+		sel, err := labels.Parse(f.selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for -argocd-cluster-selector: %w", err)
+		}
+
+		matchers = append(matchers, func(c *argocd.Cluster) bool {
+			return sel.Matches(labels.Set(c.Labels))
+		})
+	}
+
+	return func(c *argocd.Cluster) bool {
+		for _, m := range matchers {
+			if !m(c) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// selectClusters returns the clusters selected by -argocd-cluster and -argocd-cluster-selector.
+func selectClusters(clusters []clusterSecret, f argocdClusterFlags) ([]clusterSecret, error) {
+	match, err := f.match()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []clusterSecret
+
+	for _, c := range clusters {
+		if match(c.Cluster) {
+			selected = append(selected, c)
+		}
+	}
+
+	return selected, nil
+}
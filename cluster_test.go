@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+)
+
+func TestArgocdClusterFlagsMatch(t *testing.T) {
+	clusters := []*argocd.Cluster{
+		{Name: "prod-east", Server: "https://east.example.com", Labels: map[string]string{"env": "prod", "region": "east"}},
+		{Name: "prod-west", Server: "https://west.example.com", Labels: map[string]string{"env": "prod", "region": "west"}},
+		{Name: "staging", Server: "https://staging.example.com", Labels: map[string]string{"env": "staging"}},
+		{Name: "in-cluster", Server: "https://kubernetes.default.svc"},
+	}
+
+	testcases := []struct {
+		name    string
+		flags   argocdClusterFlags
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "nothing selects every cluster",
+			flags: argocdClusterFlags{},
+			want:  []string{"prod-east", "prod-west", "staging", "in-cluster"},
+		},
+		{
+			name:  "name",
+			flags: argocdClusterFlags{cluster: "name=staging"},
+			want:  []string{"staging"},
+		},
+		{
+			name:  "unknown name",
+			flags: argocdClusterFlags{cluster: "name=dev"},
+			want:  nil,
+		},
+		{
+			name:  "server",
+			flags: argocdClusterFlags{cluster: "server=https://kubernetes.default.svc"},
+			want:  []string{"in-cluster"},
+		},
+		{
+			name:  "server with trailing slash",
+			flags: argocdClusterFlags{cluster: "server=https://west.example.com/"},
+			want:  []string{"prod-west"},
+		},
+		{
+			name:  "name containing =",
+			flags: argocdClusterFlags{cluster: "name=a=b"},
+			want:  nil,
+		},
+		{
+			name:  "selector",
+			flags: argocdClusterFlags{selector: "env=prod"},
+			want:  []string{"prod-east", "prod-west"},
+		},
+		{
+			name:  "set-based selector",
+			flags: argocdClusterFlags{selector: "env in (prod,staging),region!=west"},
+			want:  []string{"prod-east", "staging"},
+		},
+		{
+			name:  "selector for the absence of the label",
+			flags: argocdClusterFlags{selector: "!env"},
+			want:  []string{"in-cluster"},
+		},
+		{
+			name:  "name and selector",
+			flags: argocdClusterFlags{cluster: "name=prod-west", selector: "region=west"},
+			want:  []string{"prod-west"},
+		},
+		{
+			name:  "name and selector that don't agree",
+			flags: argocdClusterFlags{cluster: "name=prod-west", selector: "region=east"},
+			want:  nil,
+		},
+		{
+			name:    "missing =",
+			flags:   argocdClusterFlags{cluster: "prod-west"},
+			wantErr: "It must be in the form of name=NAME or server=URL",
+		},
+		{
+			name:    "unknown key",
+			flags:   argocdClusterFlags{cluster: "label=prod"},
+			wantErr: "The key must be either name or server",
+		},
+		{
+			name:    "invalid selector",
+			flags:   argocdClusterFlags{selector: "env in (prod"},
+			wantErr: "invalid value for -argocd-cluster-selector",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			match, err := tc.flags.match()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, c := range clusters {
+				if match(c) {
+					got = append(got, c.Name)
+				}
+			}
+
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("unexpected clusters: want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterDeprecatedAlias(t *testing.T) {
+	for _, args := range [][]string{{"-argocd-namespace", "argocd"}, {"-namespace", "argocd"}} {
+		var namespace string
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVar(&namespace, "argocd-namespace", "default", "")
+		registerDeprecatedAlias(fs, "namespace", "argocd-namespace")
+
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		if namespace != "argocd" {
+			t.Errorf("%v: unexpected namespace: %q", args, namespace)
+		}
+
+		if def := fs.Lookup("namespace").DefValue; def != "default" {
+			t.Errorf("unexpected default of the alias: %q", def)
+		}
+	}
+}
+
+func TestArgocdClusterFlagsSecretNamespacedName(t *testing.T) {
+	testcases := []struct {
+		flags argocdClusterFlags
+		want  string
+	}{
+		{flags: argocdClusterFlags{secret: "cluster1"}, want: "default/cluster1"},
+		{flags: argocdClusterFlags{secret: "cluster1", namespace: "argocd"}, want: "argocd/cluster1"},
+		{flags: argocdClusterFlags{secret: "ops/cluster1", namespace: "argocd"}, want: "ops/cluster1"},
+	}
+
+	for _, tc := range testcases {
+		ns, name := tc.flags.secretNamespacedName()
+
+		if got := ns + "/" + name; got != tc.want {
+			t.Errorf("%+v: want %s, got %s", tc.flags, tc.want, got)
+		}
+	}
+}
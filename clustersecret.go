@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// clusterSecretFlags holds the flags that generate an ArgoCD cluster secret from a kubeconfig context.
+type clusterSecretFlags struct {
+	kubeconfigPath   string
+	context          string
+	name             string
+	secretName       string
+	namespace        string
+	project          string
+	namespaces       string
+	clusterResources bool
+	labels           string
+}
+
+func (f *clusterSecretFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file that contains -context")
+	fs.StringVar(&f.context, "context", "", "The kubeconfig context to convert into an ArgoCD cluster secret")
+	fs.StringVar(&f.name, "name", "", "Name of the cluster shown in the ArgoCD UI. Defaults to the name of -context")
+	fs.StringVar(&f.secretName, "secret-name", "", "Name of the ArgoCD cluster secret. Defaults to the name of -context")
+	fs.StringVar(&f.namespace, "argocd-namespace", "default", "Namespace of the ArgoCD cluster secret")
+	fs.StringVar(&f.project, "project", "", "ArgoCD project the cluster belongs to")
+	fs.StringVar(&f.namespaces, "namespaces", "", "Comma-separated list of namespaces ArgoCD is allowed to manage in the cluster. All namespaces when omitted")
+	fs.BoolVar(&f.clusterResources, "cluster-resources", false, "Allow ArgoCD to manage cluster-scoped resources when -namespaces is set")
+	fs.StringVar(&f.labels, "labels", "", "Comma-separated list of labels to add to the ArgoCD cluster secret, like env=staging,region=us-east-1")
+}
+
+// secret converts the kubeconfig context into an ArgoCD cluster secret.
+func (f clusterSecretFlags) secret() (*corev1.Secret, error) {
+	if f.context == "" {
+		return nil, fmt.Errorf("missing value for the required flag %s", "-context")
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = f.kubeconfigPath
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: f.context},
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := argocd.NewClusterConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", f.context, err)
+	}
+
+	name := f.name
+	if name == "" {
+		name = f.context
+	}
+
+	secretName := f.secretName
+	if secretName == "" {
+		secretName = f.context
+	}
+
+	if errs := validation.IsDNS1123Subdomain(secretName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid secret name %q: %s. Specify a valid one with -secret-name", secretName, strings.Join(errs, ", "))
+	}
+
+	var namespaces []string
+	for _, ns := range strings.Split(f.namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	clusterLabels, err := labels.ConvertSelectorToLabelsMap(f.labels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for -labels: %w", err)
+	}
+
+	cluster := &argocd.Cluster{
+		Server:           strings.TrimRight(restConfig.Host, "/"),
+		Name:             name,
+		Namespaces:       namespaces,
+		ClusterResources: f.clusterResources,
+		Config:           config,
+		Project:          f.project,
+		Labels:           clusterLabels,
+	}
+
+	return argocd.ClusterToSecret(cluster, f.namespace, secretName)
+}
+
+// printClusterSecret prints the ArgoCD cluster secret manifest generated from a kubeconfig context.
+func printClusterSecret(args []string) error {
+	var f clusterSecretFlags
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-print-cluster-secret", appName), flag.ExitOnError)
+	f.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	secret, err := f.secret()
+	if err != nil {
+		return err
+	}
+
+	// stringData keeps the manifest human-readable and is merged into data by the API server
+	secret.StringData = map[string]string{}
+	for k, v := range secret.Data {
+		secret.StringData[k] = string(v)
+	}
+	secret.Data = nil
+
+	data, err := yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+
+	return err
+}
+
+func apply(args []string) error {
+	if len(args) == 0 || args[0] != "cluster-secret" {
+		return fmt.Errorf("the only supported apply sub-command is \"cluster-secret\", but you provided %v", args)
+	}
+
+	args = args[1:]
+
+	var (
+		f                clusterSecretFlags
+		argocdKubeconfig string
+	)
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-apply-cluster-secret", appName), flag.ExitOnError)
+	f.register(fs)
+	fs.StringVar(&argocdKubeconfig, "argocd-kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for accessing the cluster ArgoCD is running on. The current context is used")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	secret, err := f.secret()
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := argocd.NewRestConfig(argocdKubeconfig)
+	if err != nil {
+		return err
+	}
+
+	c, err := argocd.NewClientSet(restConfig)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	secrets := c.CoreV1().Secrets(secret.Namespace)
+
+	current, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "secret/%s created\n", secret.Name)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	secret.ResourceVersion = current.ResourceVersion
+
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "secret/%s configured\n", secret.Name)
+
+	return nil
+}
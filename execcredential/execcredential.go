@@ -0,0 +1,90 @@
+// Package execcredential prints the ExecCredential that client-go reads from exec credential plugins.
+//
+// It's shared by the bundled aws, gke-gcloud-auth-plugin and kubelogin commands, and wy itself.
+// It has no dependencies so that the plugins stay dependency-free.
+package execcredential
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// API versions of the ExecCredential that client-go and kubectl may request
+const (
+	APIVersionV1Alpha1 = "client.authentication.k8s.io/v1alpha1"
+	APIVersionV1Beta1  = "client.authentication.k8s.io/v1beta1"
+	APIVersionV1       = "client.authentication.k8s.io/v1"
+)
+
+// APIVersion returns the API version of the ExecCredential requested by client-go via KUBERNETES_EXEC_INFO.
+// It defaults to v1beta1 like aws-cli, gke-gcloud-auth-plugin and kubelogin when KUBERNETES_EXEC_INFO is not set,
+// e.g. when the command is run by hand.
+//
+// The ExecCredential we print is the same across v1alpha1, v1beta1 and v1 except the apiVersion.
+func APIVersion() (string, error) {
+	info := os.Getenv("KUBERNETES_EXEC_INFO")
+	if info == "" {
+		return APIVersionV1Beta1, nil
+	}
+
+	var execInfo struct {
+		APIVersion string `json:"apiVersion"`
+	}
+
+	if err := json.Unmarshal([]byte(info), &execInfo); err != nil {
+		return "", fmt.Errorf("parsing KUBERNETES_EXEC_INFO: %w", err)
+	}
+
+	switch v := execInfo.APIVersion; v {
+	case APIVersionV1Alpha1, APIVersionV1Beta1, APIVersionV1:
+		return v, nil
+	case "":
+		return APIVersionV1Beta1, nil
+	default:
+		return "", fmt.Errorf("unsupported ExecCredential API version %q requested via KUBERNETES_EXEC_INFO. It must be one of %s, %s, or %s", v, APIVersionV1Alpha1, APIVersionV1Beta1, APIVersionV1)
+	}
+}
+
+// Print prints the token as the ExecCredential of the API version requested via KUBERNETES_EXEC_INFO.
+func Print(out io.Writer, token string, expiration time.Time) error {
+	apiVersion, err := APIVersion()
+	if err != nil {
+		return err
+	}
+
+	var execCredential struct {
+		Kind       string            `json:"kind"`
+		APIVersion string            `json:"apiVersion"`
+		Spec       map[string]string `json:"spec"`
+		Status     struct {
+			ExpirationTimestamp string `json:"expirationTimestamp"`
+			Token               string `json:"token"`
+		} `json:"status"`
+	}
+
+	execCredential.Kind = "ExecCredential"
+	execCredential.APIVersion = apiVersion
+	execCredential.Spec = map[string]string{}
+	execCredential.Status.Token = token
+	execCredential.Status.ExpirationTimestamp = expiration.UTC().Format(time.RFC3339)
+
+	return json.NewEncoder(out).Encode(execCredential)
+}
+
+// PrintError prints the error of the plugin, followed by the remediation hint when the error has a Hint() method.
+//
+// Plugins print it to stderr before exiting non-zero. client-go reports only "exec: executable NAME failed with exit code 1",
+// so stderr, which client-go and kubectl pass through, is the only place the user sees the cause.
+func PrintError(w io.Writer, plugin string, err error) {
+	fmt.Fprintf(w, "%s: error: %v\n", plugin, err)
+
+	var h interface{ Hint() string }
+
+	if errors.As(err, &h) {
+		fmt.Fprintf(w, "%s: hint: %s\n", plugin, h.Hint())
+	}
+}
@@ -0,0 +1,118 @@
+package execcredential
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrint(t *testing.T) {
+	testcases := []struct {
+		name           string
+		execInfo       string
+		wantAPIVersion string
+		wantErr        string
+	}{
+		{
+			name:           "run by hand",
+			wantAPIVersion: APIVersionV1Beta1,
+		},
+		{
+			name:           "v1",
+			execInfo:       `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			wantAPIVersion: APIVersionV1,
+		},
+		{
+			name:           "v1alpha1",
+			execInfo:       `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1alpha1"}`,
+			wantAPIVersion: APIVersionV1Alpha1,
+		},
+		{
+			name:           "no apiVersion",
+			execInfo:       `{}`,
+			wantAPIVersion: APIVersionV1Beta1,
+		},
+		{
+			name:     "unsupported apiVersion",
+			execInfo: `{"apiVersion":"client.authentication.k8s.io/v2"}`,
+			wantErr:  `unsupported ExecCredential API version "client.authentication.k8s.io/v2"`,
+		},
+		{
+			name:     "invalid KUBERNETES_EXEC_INFO",
+			execInfo: `{`,
+			wantErr:  "parsing KUBERNETES_EXEC_INFO",
+		},
+	}
+
+	expiration := time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("JST", 9*60*60))
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("KUBERNETES_EXEC_INFO", tc.execInfo)
+
+			var out bytes.Buffer
+
+			err := Print(&out, "token", expiration)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"kind":"ExecCredential","apiVersion":"` + tc.wantAPIVersion + `","spec":{},"status":{"expirationTimestamp":"2023-01-01T18:04:05Z","token":"token"}}`
+			if got := strings.TrimSpace(out.String()); got != want {
+				t.Errorf("unexpected ExecCredential:\nwant %s\ngot  %s", want, got)
+			}
+		})
+	}
+}
+
+type hintedError struct{}
+
+func (hintedError) Error() string { return "token expired" }
+
+func (hintedError) Hint() string { return "log in again" }
+
+func TestPrintError(t *testing.T) {
+	testcases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "without hint",
+			err:  errors.New("no credentials"),
+			want: "kubelogin: error: no credentials\n",
+		},
+		{
+			name: "wrapped error with hint",
+			err:  fmt.Errorf("getting token: %w", hintedError{}),
+			want: "kubelogin: error: getting token: token expired\nkubelogin: hint: log in again\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			PrintError(&buf, "kubelogin", tc.err)
+
+			if got := buf.String(); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/mumoshu/wy/execcredential
+
+go 1.16
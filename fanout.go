@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// fanOutFlags holds the flags for running a command against every selected ArgoCD cluster.
+type fanOutFlags struct {
+	enabled     bool
+	parallelism int
+}
+
+func (f *fanOutFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.enabled, "fan-out", false, "Run against every ArgoCD cluster selected by -argocd-cluster-selector or -argocd-cluster concurrently, and print the aggregated results")
+	fs.IntVar(&f.parallelism, "parallelism", 5, "Maximum number of clusters to run against concurrently with -fan-out")
+}
+
+// checkVia fails when -fan-out is combined with -via direct, which sends the requests for every cluster to the same -url.
+func (f fanOutFlags) checkVia(via string) error {
+	if f.enabled && via == viaDirect {
+		return fmt.Errorf("-fan-out requires -via %s or %s, as -via %s sends the request for every cluster to the same -url", viaPortForward, viaAPIServerProxy, viaDirect)
+	}
+
+	return nil
+}
+
+// fanOutResult is the result of running a command against a cluster.
+type fanOutResult struct {
+	Cluster  string `json:"cluster"`
+	Server   string `json:"server"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// fanOut runs fn against every cluster selected by the flags concurrently, up to parallelism clusters at a time.
+//
+// fn is given the flags that select only the cluster, the name of the cluster secret or the cluster in the source,
+// and a writer to stdout that prefixes the name to each line when the output format is text.
+func fanOut(stdout io.Writer, kubeconfigPath string, argocdCluster argocdClusterFlags, parallelism int, output string, fn func(argocdClusterFlags, string, io.Writer) error) ([]fanOutResult, error) {
+	if argocdCluster.secret != "" {
+		return nil, fmt.Errorf("-fan-out requires -argocd-cluster-selector or -argocd-cluster instead of -argocd-cluster-secret")
+	}
+
+	if argocdCluster.isZero() {
+		return nil, fmt.Errorf("missing value for the flag %s or %s required by %s", "-argocd-cluster-selector", "-argocd-cluster", "-fan-out")
+	}
+
+	source, err := newClusterSource(argocdCluster.source, kubeconfigPath, argocdCluster.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := listClusters(source)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectClusters(clusters, argocdCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no ArgoCD clusters in %s matched %s", argocdCluster.where(), argocdCluster)
+	}
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var (
+		results = make([]fanOutResult, len(selected))
+		sem     = make(chan struct{}, parallelism)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+	)
+
+	for i, c := range selected {
+		i, c := i, c
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			w := &prefixWriter{w: stdout, mu: &mu}
+			if output == outputText {
+				w.prefix = "[" + c.Name + "] "
+			}
+
+			start := time.Now()
+			err := fn(argocdClusterFlags{secret: c.ref(), source: argocdCluster.source, awsAuth: argocdCluster.awsAuth}, c.Name, w)
+			w.Flush()
+
+			results[i] = fanOutResult{
+				Cluster:  c.Name,
+				Server:   c.Cluster.Server,
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+			}
+
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+// reportFanOutResults prints the aggregated pass/fail results, and returns an error if any cluster failed.
+func reportFanOutResults(out io.Writer, results []fanOutResult, output string) error {
+	var failed int
+
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(out).Encode(results); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+		fmt.Fprintln(w, "CLUSTER\tSERVER\tRESULT\tDURATION\tERROR")
+
+		for _, r := range results {
+			result := "PASS"
+			if r.Error != "" {
+				result = "FAIL"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Cluster, r.Server, result, r.Duration, orDash(r.Error))
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d clusters failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// prefixWriter writes each line prefixed with the prefix to w.
+// Lines written by prefixWriters sharing the same mutex never interleave.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := p.writeLine(p.buf.Next(i + 1)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the last line that is not terminated by a newline, if any.
+func (p *prefixWriter) Flush() error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+
+	return p.writeLine(append(p.buf.Next(p.buf.Len()), '\n'))
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+
+	return err
+}
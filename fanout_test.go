@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	dir := t.TempDir()
+
+	for i, env := range []string{"prod", "prod", "staging", "prod", "prod", "prod"} {
+		data := fmt.Sprintf(`{"name":"c%d","server":"https://c%d.example.com","config":{"bearerToken":"t"},"labels":{"env":%q}}`, i, i, env)
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("c%d.json", i)), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := "dir:" + dir
+
+	testcases := []struct {
+		name        string
+		parallelism int
+		want        int
+	}{
+		{name: "parallelism 2", parallelism: 2, want: 2},
+		{name: "parallelism larger than the clusters", parallelism: 10, want: 5},
+		{name: "parallelism 0 runs one at a time", parallelism: 0, want: 1},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				running, max int32
+				out          bytes.Buffer
+			)
+
+			results, err := fanOut(&out, "", argocdClusterFlags{selector: "env=prod", source: source}, tc.parallelism, outputText, func(c argocdClusterFlags, name string, stdout io.Writer) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+
+				// Long enough for the other clusters to start if the parallelism allows
+				time.Sleep(50 * time.Millisecond)
+
+				if c.secret != name || c.source != source {
+					t.Errorf("unexpected flags for cluster %s: %+v", name, c)
+				}
+
+				// The last line without a newline is flushed by fanOut
+				fmt.Fprintf(stdout, "hello from\n%s", name)
+
+				if name == "c4" {
+					return errors.New("failed")
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if max != int32(tc.want) {
+				t.Errorf("unexpected maximum number of clusters run concurrently: want %d, got %d", tc.want, max)
+			}
+
+			var got []string
+			for _, r := range results {
+				got = append(got, r.Cluster+":"+r.Error)
+			}
+
+			if want := "c0:,c1:,c3:,c4:failed,c5:"; strings.Join(got, ",") != want {
+				t.Errorf("unexpected results: want %s, got %s", want, strings.Join(got, ","))
+			}
+
+			for _, name := range []string{"c0", "c1", "c3", "c4", "c5"} {
+				if want := fmt.Sprintf("[%s] hello from\n[%s] %s\n", name, name, name); !strings.Contains(out.String(), want) {
+					t.Errorf("missing output of %s: %q", name, out.String())
+				}
+			}
+		})
+	}
+
+	for _, f := range []argocdClusterFlags{{source: source}, {secret: "c0", source: source}, {selector: "env=dev", source: source}} {
+		if _, err := fanOut(ioutil.Discard, "", f, 1, outputText, func(argocdClusterFlags, string, io.Writer) error { return nil }); err == nil {
+			t.Errorf("%+v: expected an error", f)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		out bytes.Buffer
+		mu  sync.Mutex
+	)
+
+	w := &prefixWriter{prefix: "[c1] ", w: &out, mu: &mu}
+
+	for _, s := range []string{"a", "b\nc", "\n", "\n", "d"} {
+		if n, err := io.WriteString(w, s); err != nil || n != len(s) {
+			t.Fatalf("unexpected write of %q: %d, %v", s, n, err)
+		}
+	}
+
+	if got, want := out.String(), "[c1] ab\n[c1] c\n[c1] \n"; got != want {
+		t.Errorf("unexpected output before flush: want %q, got %q", want, got)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := out.String(), "[c1] ab\n[c1] c\n[c1] \n[c1] d\n"; got != want {
+		t.Errorf("unexpected output after flush: want %q, got %q", want, got)
+	}
+}
+
+func TestReportFanOutResults(t *testing.T) {
+	passed := fanOutResult{Cluster: "c1", Server: "https://c1.example.com", Duration: "1s"}
+	failed := fanOutResult{Cluster: "c2", Server: "https://c2.example.com", Duration: "2s", Error: "no ready pods"}
+
+	testcases := []struct {
+		name    string
+		results []fanOutResult
+		output  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "all passed",
+			results: []fanOutResult{passed},
+			output:  outputText,
+			want:    []string{"CLUSTER", "c1 https://c1.example.com PASS 1s -"},
+		},
+		{
+			name:    "one failed",
+			results: []fanOutResult{passed, failed},
+			output:  outputText,
+			want:    []string{"c2 https://c2.example.com FAIL 2s no ready pods"},
+			wantErr: "1 of 2 clusters failed",
+		},
+		{
+			name:    "json",
+			results: []fanOutResult{passed, failed},
+			output:  outputJSON,
+			wantErr: "1 of 2 clusters failed",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := reportFanOutResults(&out, tc.results, tc.output)
+			if tc.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+			}
+
+			// The columns are aligned with spaces, whose widths don't matter
+			var lines []string
+			for _, l := range strings.Split(out.String(), "\n") {
+				lines = append(lines, strings.Join(strings.Fields(l), " "))
+			}
+
+			for _, want := range tc.want {
+				if !strings.Contains(strings.Join(lines, "\n"), want) {
+					t.Errorf("the output is missing %q: %s", want, out.String())
+				}
+			}
+
+			if tc.output == outputJSON {
+				var got []fanOutResult
+				if err := json.Unmarshal(out.Bytes(), &got); err != nil || len(got) != len(tc.results) || got[1] != failed {
+					t.Errorf("unexpected JSON output: %s", out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutFlagsCheckVia(t *testing.T) {
+	for _, tc := range []struct {
+		flags   fanOutFlags
+		via     string
+		wantErr bool
+	}{
+		{flags: fanOutFlags{enabled: true}, via: viaDirect, wantErr: true},
+		{flags: fanOutFlags{enabled: true}, via: viaPortForward},
+		{flags: fanOutFlags{enabled: true}, via: viaAPIServerProxy},
+		{flags: fanOutFlags{}, via: viaDirect},
+	} {
+		if err := tc.flags.checkVia(tc.via); (err != nil) != tc.wantErr {
+			t.Errorf("%+v with -via %s: unexpected error: %v", tc.flags, tc.via, err)
+		}
+	}
+}
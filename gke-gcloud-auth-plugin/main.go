@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mumoshu/wy/execcredential"
+)
+
+const appName = "gke-gcloud-auth-plugin"
+
+// This is a minimal replacement of gke-gcloud-auth-plugin that is called by client-go
+// to authenticate to GKE clusters registered to ArgoCD with execProviderConfig.
+//
+// Unlike the original plugin, it doesn't require gcloud.
+// It gets the access token of the Google service account from the metadata server,
+// which is the GKE metadata server when the pod uses Workload Identity.
+func main() {
+	fs := flag.NewFlagSet(appName, flag.ExitOnError)
+
+	var (
+		serviceAccount string
+		version        bool
+	)
+
+	fs.StringVar(&serviceAccount, "service-account", "default", "The Google service account to get the access token of, in the form of EMAIL or default")
+	fs.BoolVar(&version, "version", false, "Print the version and exit")
+	// Accepted for compatibility with the original plugin, as application default credentials in a GKE pod are from the metadata server
+	fs.Bool("use_application_default_credentials", false, "Ignored. The access token is always from the metadata server")
+
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		execcredential.PrintError(os.Stderr, appName, err)
+		os.Exit(1)
+	}
+
+	if version {
+		fmt.Println(appName + " (wy)")
+		return
+	}
+
+	if err := run(os.Stdout, serviceAccount); err != nil {
+		execcredential.PrintError(os.Stderr, appName, err)
+		os.Exit(1)
+	}
+}
+
+func run(out io.Writer, serviceAccount string) error {
+	token, expiration, err := getAccessToken(context.Background(), serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	return execcredential.Print(out, token, expiration)
+}
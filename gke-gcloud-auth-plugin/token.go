@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultMetadataHost is the GCE metadata server, which is the GKE metadata server when the pod uses Workload Identity.
+// It can be overridden with GCE_METADATA_HOST, like the Google Cloud client libraries do.
+const defaultMetadataHost = "metadata.google.internal"
+
+// tokenScopes are the OAuth scopes of the access token, the same as those of gke-gcloud-auth-plugin
+var tokenScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// metadataError is returned when the metadata server is unreachable or refused to issue the token.
+type metadataError struct {
+	Host string
+	Err  error
+}
+
+func (e *metadataError) Error() string {
+	return fmt.Sprintf("getting access token from the metadata server %s: %v", e.Host, e.Err)
+}
+
+func (e *metadataError) Unwrap() error {
+	return e.Err
+}
+
+func (e *metadataError) Hint() string {
+	return "Enable Workload Identity on the GKE cluster and node pool, and annotate the Kubernetes service account of the pod with iam.gke.io/gcp-service-account. " +
+		"Outside GKE and GCE, the metadata server is unavailable. Set GCE_METADATA_HOST to point to a stand-in for testing"
+}
+
+// getAccessToken returns the access token of the Google service account, fetched from the metadata server.
+func getAccessToken(ctx context.Context, serviceAccount string) (string, time.Time, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultMetadataHost
+	}
+
+	u := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/%s/token?scopes=%s",
+		host, url.PathEscape(serviceAccount), url.QueryEscape(strings.Join(tokenScopes, ",")))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, &metadataError{Host: host, Err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", time.Time{}, &metadataError{Host: host, Err: err}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, &metadataError{Host: host, Err: fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))}
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding the token from the metadata server %s: %w", host, err)
+	}
+
+	if tok.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("the metadata server %s returned no access token", host)
+	}
+
+	return tok.AccessToken, time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAccessToken(t *testing.T) {
+	testcases := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+		// wantHint is true when the error is the one from the metadata server, which has the hint
+		wantHint bool
+	}{
+		{
+			name:   "token",
+			status: http.StatusOK,
+			body:   `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`,
+			want:   "ya29.token",
+		},
+		{
+			name:     "no Workload Identity",
+			status:   http.StatusNotFound,
+			body:     "Not Found\n",
+			wantErr:  "404 Not Found: Not Found",
+			wantHint: true,
+		},
+		{
+			name:    "no token",
+			status:  http.StatusOK,
+			body:    `{}`,
+			wantErr: "returned no access token",
+		},
+		{
+			name:    "invalid response",
+			status:  http.StatusOK,
+			body:    `<html></html>`,
+			wantErr: "decoding the token",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata-Flavor") != "Google" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" || !strings.Contains(r.URL.Query().Get("scopes"), "auth/cloud-platform") {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+			token, expiration, err := getAccessToken(context.Background(), "default")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				var metaErr *metadataError
+				if errors.As(err, &metaErr) != tc.wantHint {
+					t.Errorf("unexpected error type: %T", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token != tc.want {
+				t.Errorf("unexpected token: want %q, got %q", tc.want, token)
+			}
+
+			if d := time.Until(expiration); d < 59*time.Minute || d > time.Hour {
+				t.Errorf("unexpected expiration: %s", expiration)
+			}
+		})
+	}
+}
+
+func TestGetAccessTokenUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	var metaErr *metadataError
+	if _, _, err := getAccessToken(context.Background(), "default"); !errors.As(err, &metaErr) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -3,12 +3,18 @@ module github.com/mumoshu/wy
 go 1.16
 
 require (
-	github.com/anthhub/forwarder v1.1.1-0.20211220023309-47c50bc55038
+	github.com/mumoshu/wy/aws v0.0.0-00010101000000-000000000000
+	github.com/mumoshu/wy/execcredential v0.0.0-00010101000000-000000000000
 	github.com/prometheus/client_golang v1.11.0
 	golang.org/x/net v0.0.0-20211118161319-6a13c67c3ce4
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	k8s.io/api v0.21.3 // indirect
-	k8s.io/apimachinery v0.21.3 // indirect
-	k8s.io/client-go v0.21.3 // indirect
-	k8s.io/utils v0.0.0-20201110183641-67b214c5f920 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+	k8s.io/api v0.21.3
+	k8s.io/apimachinery v0.21.3
+	k8s.io/client-go v0.21.3
+	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
+	sigs.k8s.io/yaml v1.2.0
 )
+
+replace github.com/mumoshu/wy/aws => ./aws
+
+replace github.com/mumoshu/wy/execcredential => ./execcredential
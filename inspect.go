@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	clusterCertExpiryTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wy_cluster_cert_expiry_timestamp_seconds",
+		Help: "Expiry of the CA and client certificates in the ArgoCD cluster secrets, in seconds since the Unix epoch",
+	}, []string{"secret", "cluster", "server", "kind", "subject"})
+)
+
+// certResult is a certificate found in an ArgoCD cluster secret.
+// Secret is the name of the cluster in the source when -cluster-source isn't argocd-secrets.
+type certResult struct {
+	Secret  string `json:"secret"`
+	Cluster string `json:"cluster,omitempty"`
+	Server  string `json:"server,omitempty"`
+	argocd.CertInfo
+	// Expiring is true when the certificate expires within -warn-within
+	Expiring bool   `json:"expiring,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func inspect(args []string) error {
+	if len(args) == 0 || args[0] != "certs" {
+		return fmt.Errorf("the only supported inspect sub-command is \"certs\", but you provided %v", args)
+	}
+
+	args = args[1:]
+
+	var (
+		kubeconfigPath string
+		argocdCluster  argocdClusterFlags
+		output         string
+		warnWithin     string
+		metricsBind    string
+		interval       time.Duration
+	)
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-inspect-certs", appName), flag.ExitOnError)
+	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for accessing the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.namespace, "argocd-namespace", "default", "Namespace of the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.source, "cluster-source", clusterSourceSecrets, clusterSourceUsage)
+	fs.StringVar(&argocdCluster.secret, "argocd-cluster-secret", "", "Name of the cluster secret to inspect, in the form of NAME or NAMESPACE/NAME. With -cluster-source other than argocd-secrets, the name of the cluster in the source. All the clusters are inspected when omitted")
+	fs.StringVar(&argocdCluster.selector, "argocd-cluster-selector", "", "Label selector of the cluster secrets to inspect, like env=staging")
+	fs.StringVar(&output, "output", outputText, "Output format. One of text and json")
+	fs.StringVar(&warnWithin, "warn-within", "", "Fail when any certificate expires within the duration, like 30d or 72h")
+	fs.StringVar(&metricsBind, "metrics-bind", "", "The socket to serve the wy_cluster_cert_expiry_timestamp_seconds metric from. When set, the command keeps running and inspects the certificates every -interval")
+	fs.DurationVar(&interval, "interval", time.Minute, "Interval between each inspection when -metrics-bind is set")
+	registerDeprecatedAlias(fs, "namespace", "argocd-namespace")
+	registerDeprecatedAlias(fs, "secret", "argocd-cluster-secret")
+	registerDeprecatedAlias(fs, "selector", "argocd-cluster-selector")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unsupported value for -output: %q. It must be one of %s or %s", output, outputText, outputJSON)
+	}
+
+	var within *time.Duration
+
+	if warnWithin != "" {
+		d, err := parseDays(warnWithin)
+		if err != nil {
+			return fmt.Errorf("invalid value for -warn-within: %w", err)
+		}
+
+		within = &d
+	}
+
+	sel, err := labels.Parse(argocdCluster.selector)
+	if err != nil {
+		return fmt.Errorf("invalid value for -argocd-cluster-selector: %w", err)
+	}
+
+	inspectOnce := func() ([]certResult, error) {
+		now := time.Now()
+
+		results := []certResult{}
+
+		if !argocdCluster.isSecretSource() {
+			clusters, err := getClusters(kubeconfigPath, argocdCluster)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, c := range clusters {
+				results = inspectCluster(results, c.ref(), c.Cluster, now, within)
+			}
+
+			return results, nil
+		}
+
+		secrets, err := getClusterSecrets(kubeconfigPath, argocdCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range secrets {
+			s := &secrets[i]
+
+			if !sel.Matches(labels.Set(s.Labels)) {
+				continue
+			}
+
+			name := s.Namespace + "/" + s.Name
+
+			cluster, err := argocd.SecretToCluster(s)
+			if err != nil {
+				results = append(results, certResult{Secret: name, Error: err.Error()})
+				continue
+			}
+
+			results = inspectCluster(results, name, cluster, now, within)
+		}
+
+		return results, nil
+	}
+
+	if metricsBind != "" {
+		r := prometheus.NewRegistry()
+		r.MustRegister(clusterCertExpiryTimestampSeconds)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+
+		go func() {
+			if err := http.ListenAndServe(metricsBind, mux); err != nil {
+				log.Printf("Unable to serve metrics: %v", err)
+			}
+		}()
+
+		for {
+			results, err := inspectOnce()
+			if err != nil {
+				log.Printf("Unable to inspect certificates: %v", err)
+			} else {
+				clusterCertExpiryTimestampSeconds.Reset()
+
+				for _, r := range results {
+					if r.Error != "" {
+						log.Printf("Unable to inspect certificates in %s: %s", r.Secret, r.Error)
+						continue
+					}
+
+					clusterCertExpiryTimestampSeconds.WithLabelValues(r.Secret, r.Cluster, r.Server, r.Kind, r.Subject).Set(float64(r.NotAfter.Unix()))
+				}
+			}
+
+			time.Sleep(interval)
+		}
+	}
+
+	results, err := inspectOnce()
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := printCertResults(os.Stdout, results); err != nil {
+		return err
+	}
+
+	var expiring, failed int
+
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		} else if r.Expiring {
+			expiring++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to inspect certificates in %d cluster secrets", failed)
+	}
+
+	if expiring > 0 {
+		return fmt.Errorf("%d certificates expire within %s", expiring, warnWithin)
+	}
+
+	return nil
+}
+
+// inspectCluster appends the certificates of the cluster to results.
+// A certificate is marked as expiring when it expires within the duration. Nothing is marked when within is nil.
+func inspectCluster(results []certResult, name string, cluster *argocd.Cluster, now time.Time, within *time.Duration) []certResult {
+	certs, err := cluster.Certificates()
+	if err != nil {
+		return append(results, certResult{Secret: name, Cluster: cluster.Name, Server: cluster.Server, Error: err.Error()})
+	}
+
+	for _, c := range certs {
+		results = append(results, certResult{
+			Secret:   name,
+			Cluster:  cluster.Name,
+			Server:   cluster.Server,
+			CertInfo: c,
+			Expiring: within != nil && c.NotAfter.Before(now.Add(*within)),
+		})
+	}
+
+	return results
+}
+
+func printCertResults(out io.Writer, results []certResult) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SECRET\tKIND\tSUBJECT\tSANS\tISSUER\tNOT AFTER\tSTATUS")
+
+	now := time.Now()
+
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t%s\n", r.Secret, r.Error)
+			continue
+		}
+
+		status := "OK"
+		if r.NotAfter.Before(now) {
+			status = "EXPIRED"
+		} else if r.Expiring {
+			status = "EXPIRING"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Secret, r.Kind, orDash(r.Subject), orDash(strings.Join(r.SANs, ",")), orDash(r.Issuer), r.NotAfter.Format(time.RFC3339), status)
+	}
+
+	return w.Flush()
+}
+
+// parseDays is time.ParseDuration that additionally accepts a number of days like 30d.
+func parseDays(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+)
+
+func TestParseDays(t *testing.T) {
+	testcases := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "0d", want: 0},
+		{in: "720h", want: 720 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "30", wantErr: true},
+		{in: "thirty days", wantErr: true},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parseDays(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// selfSignedCertificate returns a PEM-encoded certificate that expires at notAfter.
+func selfSignedCertificate(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kubernetes-ca"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestInspectClusterWarnWithin(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	thirtyDays := 30 * 24 * time.Hour
+
+	testcases := []struct {
+		name      string
+		expiresIn time.Duration
+		within    *time.Duration
+		want      bool
+	}{
+		{name: "no -warn-within", expiresIn: time.Hour, within: nil, want: false},
+		{name: "expires within", expiresIn: thirtyDays - time.Second, within: &thirtyDays, want: true},
+		{name: "expires exactly at the threshold", expiresIn: thirtyDays, within: &thirtyDays, want: false},
+		{name: "expires after", expiresIn: thirtyDays + time.Hour, within: &thirtyDays, want: false},
+		{name: "already expired", expiresIn: -time.Hour, within: &thirtyDays, want: true},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &argocd.Cluster{Name: "prod", Server: "https://10.0.0.1:6443"}
+			cluster.Config.TLSClientConfig.CAData = selfSignedCertificate(t, now.Add(tc.expiresIn))
+
+			results := inspectCluster(nil, "prod", cluster, now, tc.within)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %+v", results)
+			}
+
+			if r := results[0]; r.Error != "" || r.Expiring != tc.want {
+				t.Errorf("unexpected result: want expiring=%v, got %+v", tc.want, r)
+			}
+		})
+	}
+}
+
+func TestInspectClusterInvalidCertificate(t *testing.T) {
+	cluster := &argocd.Cluster{Name: "prod", Server: "https://10.0.0.1:6443"}
+	cluster.Config.TLSClientConfig.CAData = []byte("not a certificate")
+
+	results := inspectCluster(nil, "prod", cluster, time.Now(), nil)
+	if len(results) != 1 || results[0].Error == "" {
+		t.Errorf("expected a result with the error, got %+v", results)
+	}
+}
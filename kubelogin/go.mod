@@ -0,0 +1,7 @@
+module github.com/mumoshu/wy/kubelogin
+
+go 1.16
+
+require github.com/mumoshu/wy/execcredential v0.0.0-00010101000000-000000000000
+
+replace github.com/mumoshu/wy/execcredential => ../execcredential
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mumoshu/wy/execcredential"
+)
+
+const appName = "kubelogin"
+
+// The login methods of kubelogin that are supported
+const (
+	loginWorkloadIdentity = "workloadidentity"
+	loginMSI              = "msi"
+)
+
+// This is a minimal replacement of kubelogin that is called by client-go
+// to authenticate to AKS clusters registered to ArgoCD with execProviderConfig.
+//
+// It implements only `kubelogin get-token` with the workloadidentity and msi logins,
+// which are the ones that work non-interactively in a pod.
+func main() {
+	if err := run(os.Stdout, os.Args[1:]); err != nil {
+		execcredential.PrintError(os.Stderr, appName, err)
+		os.Exit(1)
+	}
+}
+
+func run(out io.Writer, args []string) error {
+	if len(args) == 0 || args[0] != "get-token" {
+		return fmt.Errorf("the only supported %s sub-command is get-token", appName)
+	}
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-get-token", appName), flag.ExitOnError)
+
+	var (
+		login, serverID, environment string
+		wi                           workloadIdentityOptions
+	)
+
+	authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authorityHost == "" {
+		authorityHost = defaultAuthorityHost
+	}
+
+	fs.StringVar(&login, "login", envOr("AAD_LOGIN_METHOD", loginWorkloadIdentity), fmt.Sprintf("Login method. One of %s and %s", loginWorkloadIdentity, loginMSI))
+	fs.StringVar(&login, "l", envOr("AAD_LOGIN_METHOD", loginWorkloadIdentity), "Shorthand for -login")
+	fs.StringVar(&serverID, "server-id", "", "The application ID of the AKS AAD server, which is 6dae42f8-4368-4678-94ff-3960e28e3630 for AKS-managed AAD")
+	fs.StringVar(&wi.ClientID, "client-id", os.Getenv("AZURE_CLIENT_ID"), "The client ID of the managed identity or the app")
+	fs.StringVar(&wi.TenantID, "tenant-id", os.Getenv("AZURE_TENANT_ID"), "The tenant ID of the managed identity or the app")
+	fs.StringVar(&wi.AuthorityHost, "authority-host", authorityHost, "The Azure AD endpoint for workloadidentity login")
+	fs.StringVar(&wi.FederatedTokenFile, "federated-token-file", os.Getenv("AZURE_FEDERATED_TOKEN_FILE"), "The service account token projected by Azure Workload Identity for workloadidentity login")
+	// Accepted for compatibility with kubelogin. The cloud is determined by -authority-host, which Azure Workload Identity sets
+	fs.StringVar(&environment, "environment", "AzurePublicCloud", "Ignored. The cloud is determined by -authority-host")
+	fs.StringVar(&environment, "e", "AzurePublicCloud", "Ignored. Shorthand for -environment")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if serverID == "" {
+		return fmt.Errorf("-server-id is required")
+	}
+
+	ctx := context.Background()
+
+	var getToken func() (string, time.Time, error)
+
+	switch login {
+	case loginWorkloadIdentity:
+		getToken = func() (string, time.Time, error) { return getWorkloadIdentityToken(ctx, serverID, wi) }
+	case loginMSI:
+		getToken = func() (string, time.Time, error) { return getMSIToken(ctx, serverID, wi.ClientID) }
+	default:
+		return fmt.Errorf("unsupported login method %q. It must be one of %s and %s, as the other methods require a browser or secrets", login, loginWorkloadIdentity, loginMSI)
+	}
+
+	token, expiration, err := getToken()
+	if err != nil {
+		return err
+	}
+
+	return execcredential.Print(out, token, expiration)
+}
+
+func envOr(name, defaultValue string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAuthorityHost is the Azure AD endpoint of the Azure public cloud.
+	// Azure Workload Identity sets AZURE_AUTHORITY_HOST to the one of the cloud the cluster is in.
+	defaultAuthorityHost = "https://login.microsoftonline.com/"
+
+	// defaultIMDSEndpoint is the Azure Instance Metadata Service.
+	// It can be overridden with AZURE_POD_IDENTITY_AUTHORITY_HOST, like the Azure SDK does.
+	defaultIMDSEndpoint = "http://169.254.169.254"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// tokenError is returned when Azure AD or the Instance Metadata Service is unreachable or refused to issue the token.
+type tokenError struct {
+	Login    string
+	Endpoint string
+	Err      error
+}
+
+func (e *tokenError) Error() string {
+	return fmt.Sprintf("getting token with %s login from %s: %v", e.Login, e.Endpoint, e.Err)
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.Err
+}
+
+func (e *tokenError) Hint() string {
+	switch e.Login {
+	case loginWorkloadIdentity:
+		return "Ensure that the pod has the label azure.workload.identity/use=true, its service account is annotated with azure.workload.identity/client-id, " +
+			"and the managed identity or the app has the federated credential for the service account"
+	default:
+		return "Ensure that the node has the managed identity assigned, and set --client-id when it has multiple. " +
+			"Outside Azure, the Instance Metadata Service is unavailable. Set AZURE_POD_IDENTITY_AUTHORITY_HOST to point to a stand-in for testing"
+	}
+}
+
+// workloadIdentityOptions is the flags of kubelogin's workloadidentity login.
+type workloadIdentityOptions struct {
+	ClientID           string
+	TenantID           string
+	AuthorityHost      string
+	FederatedTokenFile string
+}
+
+// getWorkloadIdentityToken exchanges the service account token projected by Azure Workload Identity for the Azure AD token of the server.
+func getWorkloadIdentityToken(ctx context.Context, serverID string, o workloadIdentityOptions) (string, time.Time, error) {
+	for _, v := range []struct{ name, value string }{
+		{"--client-id or AZURE_CLIENT_ID", o.ClientID},
+		{"--tenant-id or AZURE_TENANT_ID", o.TenantID},
+		{"--federated-token-file or AZURE_FEDERATED_TOKEN_FILE", o.FederatedTokenFile},
+	} {
+		if v.value == "" {
+			return "", time.Time{}, &tokenError{Login: loginWorkloadIdentity, Endpoint: o.AuthorityHost, Err: fmt.Errorf("%s is required", v.name)}
+		}
+	}
+
+	assertion, err := ioutil.ReadFile(o.FederatedTokenFile)
+	if err != nil {
+		return "", time.Time{}, &tokenError{Login: loginWorkloadIdentity, Endpoint: o.AuthorityHost, Err: err}
+	}
+
+	endpoint := strings.TrimRight(o.AuthorityHost, "/") + "/" + url.PathEscape(o.TenantID) + "/oauth2/v2.0/token"
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {o.ClientID},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+		"scope":                 {serverID + "/.default"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doTokenRequest(req, loginWorkloadIdentity, endpoint)
+}
+
+// getMSIToken returns the token of the managed identity assigned to the node, fetched from the Instance Metadata Service.
+// The clientID selects the user-assigned managed identity, when the node has multiple.
+func getMSIToken(ctx context.Context, serverID, clientID string) (string, time.Time, error) {
+	host := os.Getenv("AZURE_POD_IDENTITY_AUTHORITY_HOST")
+	if host == "" {
+		host = defaultIMDSEndpoint
+	}
+
+	q := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {serverID},
+	}
+
+	if clientID != "" {
+		q.Set("client_id", clientID)
+	}
+
+	endpoint := strings.TrimRight(host, "/") + "/metadata/identity/oauth2/token"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Metadata", "true")
+
+	return doTokenRequest(req, loginMSI, endpoint)
+}
+
+func doTokenRequest(req *http.Request, login, endpoint string) (string, time.Time, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, &tokenError{Login: login, Endpoint: endpoint, Err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", time.Time{}, &tokenError{Login: login, Endpoint: endpoint, Err: err}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+
+		msg := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			msg = e.Error + ": " + e.ErrorDescription
+		}
+
+		return "", time.Time{}, &tokenError{Login: login, Endpoint: endpoint, Err: fmt.Errorf("%s: %s", res.Status, msg)}
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresIn is a number in Azure AD responses, but a string in the Instance Metadata Service responses
+		ExpiresIn json.RawMessage `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding the token from %s: %w", endpoint, err)
+	}
+
+	if tok.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("%s returned no access token", endpoint)
+	}
+
+	expiresIn, err := strconv.ParseInt(strings.Trim(string(tok.ExpiresIn), `"`), 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding expires_in of the token from %s: %w", endpoint, err)
+	}
+
+	return tok.AccessToken, time.Now().Add(time.Duration(expiresIn) * time.Second), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serverID is the application ID of the AKS AAD server
+const serverID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+func TestGetWorkloadIdentityToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/tenant/oauth2/v2.0/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.PostForm.Get("client_assertion") != "sa-token" || r.PostForm.Get("client_assertion_type") != clientAssertionType ||
+			r.PostForm.Get("scope") != serverID+"/.default" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request","error_description":"unexpected form"}`))
+			return
+		}
+
+		if r.PostForm.Get("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"unauthorized_client","error_description":"AADSTS700016: Application not found"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"aad-token"}`))
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	if err := ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name    string
+		opts    workloadIdentityOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name: "token",
+			opts: workloadIdentityOptions{ClientID: "client", TenantID: "tenant", AuthorityHost: srv.URL + "/", FederatedTokenFile: tokenFile},
+			want: "aad-token",
+		},
+		{
+			name:    "unknown client",
+			opts:    workloadIdentityOptions{ClientID: "other", TenantID: "tenant", AuthorityHost: srv.URL, FederatedTokenFile: tokenFile},
+			wantErr: "400 Bad Request: unauthorized_client: AADSTS700016: Application not found",
+		},
+		{
+			name:    "missing tenant",
+			opts:    workloadIdentityOptions{ClientID: "client", AuthorityHost: srv.URL, FederatedTokenFile: tokenFile},
+			wantErr: "--tenant-id or AZURE_TENANT_ID is required",
+		},
+		{
+			name:    "missing token file",
+			opts:    workloadIdentityOptions{ClientID: "client", TenantID: "tenant", AuthorityHost: srv.URL, FederatedTokenFile: filepath.Join(t.TempDir(), "missing")},
+			wantErr: "no such file or directory",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			token, expiration, err := getWorkloadIdentityToken(context.Background(), serverID, tc.opts)
+			checkToken(t, token, expiration, err, tc.want, tc.wantErr)
+		})
+	}
+}
+
+func TestGetMSIToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/identity/oauth2/token" || q.Get("resource") != serverID || q.Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// The node has two user-assigned identities, so the client ID is required
+		if q.Get("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request","error_description":"Multiple user assigned identities exist, please specify the clientId / resourceId of the identity in the token request"}`))
+			return
+		}
+
+		// Unlike Azure AD, the Instance Metadata Service returns expires_in as a string
+		_, _ = w.Write([]byte(`{"access_token":"msi-token","expires_in":"3599","token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", srv.URL)
+
+	testcases := []struct {
+		name     string
+		clientID string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "token",
+			clientID: "client",
+			want:     "msi-token",
+		},
+		{
+			name:    "multiple identities",
+			wantErr: "400 Bad Request: invalid_request: Multiple user assigned identities exist",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			token, expiration, err := getMSIToken(context.Background(), serverID, tc.clientID)
+			checkToken(t, token, expiration, err, tc.want, tc.wantErr)
+		})
+	}
+}
+
+func checkToken(t *testing.T, token string, expiration time.Time, err error, want, wantErr string) {
+	t.Helper()
+
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("unexpected error: want %q, got %v", wantErr, err)
+		}
+
+		var tokenErr *tokenError
+		if !errors.As(err, &tokenErr) {
+			t.Errorf("unexpected error type: %T", err)
+		}
+
+		return
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != want {
+		t.Errorf("unexpected token: want %q, got %q", want, token)
+	}
+
+	if d := time.Until(expiration); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("unexpected expiration: %s", expiration)
+	}
+}
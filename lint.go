@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func lint(args []string) error {
+	if len(args) == 0 || args[0] != "cluster-secret" {
+		return fmt.Errorf("the only supported lint sub-command is \"cluster-secret\", but you provided %v", args)
+	}
+
+	args = args[1:]
+
+	var (
+		file           string
+		kubeconfigPath string
+		argocdCluster  argocdClusterFlags
+		output         string
+	)
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-lint-cluster-secret", appName), flag.ExitOnError)
+	fs.StringVar(&file, "f", "", "Path to the YAML or JSON file that contains one or more cluster secrets to lint offline. - for stdin. When omitted, the cluster secrets are read from the cluster")
+	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for accessing the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.namespace, "argocd-namespace", "default", "Namespace of the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.source, "cluster-source", clusterSourceSecrets, clusterSourceUsage+". The clusters read from sources other than argocd-secrets are linted as the cluster secrets they are converted into")
+	fs.StringVar(&argocdCluster.secret, "argocd-cluster-secret", "", "Name of the cluster secret to lint, in the form of NAME or NAMESPACE/NAME. With -cluster-source other than argocd-secrets, the name of the cluster in the source. All the clusters are linted when omitted")
+	fs.StringVar(&argocdCluster.selector, "argocd-cluster-selector", "", "Label selector of the cluster secrets to lint, like env=staging")
+	fs.StringVar(&output, "output", outputText, "Output format. One of text and json")
+	registerDeprecatedAlias(fs, "namespace", "argocd-namespace")
+	registerDeprecatedAlias(fs, "secret", "argocd-cluster-secret")
+	registerDeprecatedAlias(fs, "selector", "argocd-cluster-selector")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unsupported value for -output: %q. It must be one of %s or %s", output, outputText, outputJSON)
+	}
+
+	var (
+		secrets []corev1.Secret
+		err     error
+	)
+
+	switch {
+	case file != "":
+		secrets, err = readSecrets(file)
+	case argocdCluster.isSecretSource():
+		secrets, err = getClusterSecrets(kubeconfigPath, argocdCluster)
+	default:
+		secrets, err = getSourceClusterSecrets(kubeconfigPath, argocdCluster)
+	}
+	if err != nil {
+		return err
+	}
+
+	sel, err := labels.Parse(argocdCluster.selector)
+	if err != nil {
+		return fmt.Errorf("invalid value for -argocd-cluster-selector: %w", err)
+	}
+
+	findings := []argocd.Finding{}
+	now := time.Now()
+
+	var errors int
+
+	for i := range secrets {
+		s := &secrets[i]
+
+		if !sel.Matches(labels.Set(s.Labels)) {
+			continue
+		}
+
+		for _, f := range argocd.LintSecret(s, now) {
+			if f.Severity == argocd.SeverityError {
+				errors++
+			}
+
+			findings = append(findings, f)
+		}
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else if err := printFindings(os.Stdout, findings); err != nil {
+		return err
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("found %d errors in cluster secrets", errors)
+	}
+
+	return nil
+}
+
+// getClusterSecrets returns the secret named by -argocd-cluster-secret, or all the ArgoCD cluster secrets in -argocd-namespace when it's empty.
+func getClusterSecrets(kubeconfigPath string, argocdCluster argocdClusterFlags) ([]corev1.Secret, error) {
+	restConfig, err := getRestConfig(kubeconfigPath, argocdClusterFlags{})
+	if err != nil {
+		return nil, err
+	}
+
+	if argocdCluster.secret == "" {
+		return listClusterSecrets(restConfig, argocdCluster.namespace)
+	}
+
+	c, err := argocd.NewClientSet(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ns, name := argocdCluster.secretNamespacedName()
+
+	s, err := c.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return []corev1.Secret{*s}, nil
+}
+
+// getSourceClusterSecrets returns the clusters in the cluster source selected by the flags, converted into the cluster secrets.
+func getSourceClusterSecrets(kubeconfigPath string, argocdCluster argocdClusterFlags) ([]corev1.Secret, error) {
+	clusters, err := getClusters(kubeconfigPath, argocdCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var secrets []corev1.Secret
+
+	for _, c := range clusters {
+		s, err := argocd.ClusterToSecret(c.Cluster, c.Namespace, c.Name)
+		if err != nil {
+			return nil, fmt.Errorf("converting cluster %s: %w", c.ref(), err)
+		}
+
+		secrets = append(secrets, *s)
+	}
+
+	return secrets, nil
+}
+
+// readSecrets reads the secrets in the YAML or JSON file.
+// stringData is merged into data the same way as the API server does.
+func readSecrets(file string) ([]corev1.Secret, error) {
+	var r io.Reader
+
+	if file == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	dec := yaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	var secrets []corev1.Secret
+
+	for {
+		var s corev1.Secret
+
+		if err := dec.Decode(&s); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+
+		if s.Kind == "" && s.Name == "" {
+			// An empty document
+			continue
+		}
+
+		if s.Kind != "Secret" {
+			return nil, fmt.Errorf("reading %s: unexpected kind %q: it must be Secret", file, s.Kind)
+		}
+
+		if len(s.StringData) > 0 && s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+
+		for k, v := range s.StringData {
+			s.Data[k] = []byte(v)
+		}
+
+		secrets = append(secrets, s)
+	}
+
+	return secrets, nil
+}
+
+func printFindings(out io.Writer, findings []argocd.Finding) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SECRET\tSEVERITY\tFIELD\tMESSAGE")
+
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Secret, f.Severity, f.Field, f.Message)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func list(args []string) error {
+	if len(args) == 0 || args[0] != "clusters" {
+		return fmt.Errorf("the only supported list sub-command is \"clusters\", but you provided %v", args)
+	}
+
+	args = args[1:]
+
+	var (
+		kubeconfigPath string
+		argocdCluster  argocdClusterFlags
+		output         string
+		argocdServer   argocdServerFlags
+	)
+
+	fs := flag.NewFlagSet(fmt.Sprintf("%s-list-clusters", appName), flag.ExitOnError)
+	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for accessing the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.namespace, "argocd-namespace", "default", "Namespace of the ArgoCD cluster secrets")
+	fs.StringVar(&argocdCluster.source, "cluster-source", clusterSourceSecrets, clusterSourceUsage)
+	fs.StringVar(&argocdCluster.selector, "argocd-cluster-selector", "", "Label selector of the ArgoCD clusters to list, like env=staging")
+	fs.StringVar(&output, "output", outputText, "Output format. One of text and json")
+	argocdServer.register(fs)
+	registerDeprecatedAlias(fs, "namespace", "argocd-namespace")
+	registerDeprecatedAlias(fs, "selector", "argocd-cluster-selector")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unsupported value for -output: %q. It must be one of %s or %s", output, outputText, outputJSON)
+	}
+
+	clusters, err := listClustersWithFallback(kubeconfigPath, argocdCluster.source, argocdCluster.namespace, argocdServer)
+	if err != nil {
+		return err
+	}
+
+	clusters, err = selectClusters(clusters, argocdCluster)
+	if err != nil {
+		return err
+	}
+
+	summaries := make([]clusterSummary, 0, len(clusters))
+	for _, c := range clusters {
+		summaries = append(summaries, summarizeCluster(c))
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	}
+
+	return printClusterSummaries(os.Stdout, summaries)
+}
+
+// clusterSummary is the printable summary of an ArgoCD cluster.
+// It must never contain credentials.
+type clusterSummary struct {
+	Secret      string            `json:"secret,omitempty"`
+	Name        string            `json:"name"`
+	Server      string            `json:"server"`
+	Project     string            `json:"project,omitempty"`
+	Shard       *int64            `json:"shard,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	AuthMethods []string          `json:"authMethods"`
+}
+
+func summarizeCluster(c clusterSecret) clusterSummary {
+	s := clusterSummary{
+		Name:    c.Cluster.Name,
+		Server:  c.Cluster.Server,
+		Project: c.Cluster.Project,
+		Shard:   c.Cluster.Shard,
+		Labels:  c.Cluster.Labels,
+	}
+
+	// The auth methods are unknown for clusters fetched from the ArgoCD API server, as it redacts the credentials
+	if c.Name != "" {
+		s.Secret = c.ref()
+		s.AuthMethods = c.Cluster.AuthMethods()
+	}
+
+	return s
+}
+
+func printClusterSummaries(out io.Writer, summaries []clusterSummary) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SECRET\tNAME\tSERVER\tPROJECT\tSHARD\tLABELS\tAUTH")
+
+	for _, s := range summaries {
+		shard := "-"
+		if s.Shard != nil {
+			shard = fmt.Sprintf("%d", *s.Shard)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			orDash(s.Secret),
+			orDash(s.Name),
+			s.Server,
+			orDash(s.Project),
+			shard,
+			orDash(labelsString(s.Labels)),
+			orDash(strings.Join(s.AuthMethods, ",")),
+		)
+	}
+
+	return w.Flush()
+}
+
+func labelsString(labels map[string]string) string {
+	var kvs []string
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+
+	return strings.Join(kvs, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
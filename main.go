@@ -3,20 +3,27 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
-	"github.com/anthhub/forwarder"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 var (
@@ -66,9 +73,19 @@ func run(args []string) error {
 		return get(fs.Args()[1:])
 	case "repeat":
 		return repeat(fs.Args()[1:])
+	case "list":
+		return list(fs.Args()[1:])
+	case "check":
+		return check(fs.Args()[1:])
+	case "apply":
+		return apply(fs.Args()[1:])
+	case "lint":
+		return lint(fs.Args()[1:])
+	case "inspect":
+		return inspect(fs.Args()[1:])
 	}
 
-	fmt.Fprintf(os.Stderr, "Command %q does not exist\n\nAvailable commands:\n  serve\n  get\n  repeat\n", fs.Arg(0))
+	fmt.Fprintf(os.Stderr, "Command %q does not exist\n\nAvailable commands:\n  serve\n  get\n  repeat\n  print\n  list\n  check\n  apply\n  lint\n  inspect\n", fs.Arg(0))
 	fs.Usage()
 	return nil
 }
@@ -81,21 +98,40 @@ func repeat(args []string) error {
 		interval time.Duration
 		forever  bool
 
-		argocdClusterSecret string
+		argocdCluster       argocdClusterFlags
+		namespace           string
 		service             string
+		pod                 string
+		selector            string
+		allPods             bool
 		localPort           int
 		remotePort          int
 		kubeconfigPath      string
+		healthCheckInterval time.Duration
+		metricsBind         string
+		via                 string
+		output              string
+		fanOutOpts          fanOutFlags
 	)
 
 	fs.IntVar(&count, "count", 5, "Number of repetitions")
 	fs.DurationVar(&interval, "interval", time.Second, "Delay between each request")
 	fs.BoolVar(&forever, "forever", false, "Repeat HTTP requests infinite number of times. If true, -count is ignored")
-	fs.StringVar(&argocdClusterSecret, "argocd-cluster-secret", "", "Name of the Kubernetes secret that contains an ArgoCD-style cluster connection info. If specified, it uses port-forwarding to access the target server")
-	fs.StringVar(&service, "service", "", "Name of the Kubernetes service that is connected to the pods. Required if you'd want access the app via Kubernetes port-forwarding")
-	fs.IntVar(&localPort, "local-port", 8080, "Port part of the URL to the server")
-	fs.IntVar(&remotePort, "remote-port", 8080, "Port part of the URL to the server")
+	argocdCluster.register(fs)
+	rejectArgocdServer(fs)
+	fs.StringVar(&namespace, "namespace", "", "Namespace of the Kubernetes service or pods to access. Defaults to \"default\"")
+	fs.StringVar(&service, "service", "", "Name of the Kubernetes service that is connected to the pods, in the form of NAME or NAMESPACE/NAME. Required if you'd want access the app via Kubernetes port-forwarding")
+	fs.StringVar(&pod, "pod", "", "Name of the Kubernetes pod to access, in the form of NAME or NAMESPACE/NAME. Can be used instead of -service")
+	fs.StringVar(&selector, "selector", "", "Label selector of the pods to port-forward to, like app=wy-serve. Can be used instead of -service")
+	fs.BoolVar(&allPods, "all-pods", false, "Port-forward to every ready pod selected by -service or -selector on consecutive local ports starting from -local-port, and send requests to the pods in a round-robin manner")
+	fs.IntVar(&localPort, "local-port", 8080, "Port part of the URL to the server. 0 allocates a free local port for port-forwarding and rewrites the host and the port of -url accordingly")
+	fs.StringVar(&output, "output", outputText, "Output format. One of text and json. json prints a JSON object per request, containing the pod and the local port when port-forwarding")
+	fs.IntVar(&remotePort, "remote-port", 8080, "Port part of the URL to the server. The pod port when port-forwarding, or the service port when accessing via the API server proxy")
+	fs.StringVar(&via, "via", "", "How to reach the server. One of direct, port-forward, and apiserver-proxy. Defaults to port-forward when -service or -selector is specified, direct otherwise")
 	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for port-forwarding")
+	fs.DurationVar(&healthCheckInterval, "health-check-interval", 10*time.Second, "Interval between each health check of the port-forward. The port-forward is re-established to another ready pod when the check fails. 0 disables health checks")
+	fs.StringVar(&metricsBind, "metrics-bind", "", "The socket to serve Prometheus metrics like port_forward_reconnects_total from. Metrics are not served if empty")
+	fanOutOpts.register(fs)
 
 	cmd := args[0]
 
@@ -106,57 +142,311 @@ func repeat(args []string) error {
 			return err
 		}
 
-		if service != "" {
-			options := []*forwarder.Option{
-				{
-					LocalPort:   localPort,
-					RemotePort:  remotePort,
-					ServiceName: service,
-				},
+		if metricsBind != "" {
+			r := prometheus.NewRegistry()
+			r.MustRegister(portForwardReconnectsTotal)
+
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+
+			go func() {
+				if err := http.ListenAndServe(metricsBind, mux); err != nil {
+					log.Printf("Unable to serve metrics: %v", err)
+				}
+			}()
+		}
+
+		if output != outputText && output != outputJSON {
+			return fmt.Errorf("unsupported value for -output: %q. It must be one of %s or %s", output, outputText, outputJSON)
+		}
+
+		target, err := newPortForwardTarget(namespace, service, pod, selector)
+		if err != nil {
+			return err
+		}
+
+		via, err = resolveVia(via, target)
+		if err != nil {
+			return err
+		}
+
+		if err := fanOutOpts.checkVia(via); err != nil {
+			return err
+		}
+
+		o := repeatGetOptions{
+			kubeconfigPath:      kubeconfigPath,
+			argocdCluster:       argocdCluster,
+			count:               count,
+			interval:            interval,
+			forever:             forever,
+			target:              target,
+			via:                 via,
+			allPods:             allPods,
+			localPort:           localPort,
+			remotePort:          remotePort,
+			healthCheckInterval: healthCheckInterval,
+			url:                 url,
+			print:               print,
+			output:              output,
+		}
+
+		ctx := context.Background()
+
+		if !fanOutOpts.enabled {
+			return repeatGet(ctx, o, os.Stdout)
+		}
+
+		if via == viaPortForward && localPort != 0 {
+			// Every cluster needs its own local port
+			log.Printf("Allocating free local ports for port-forwarding to each cluster, ignoring -local-port %d", localPort)
+			o.localPort = 0
+		}
+
+		results, err := fanOut(os.Stdout, kubeconfigPath, argocdCluster, fanOutOpts.parallelism, output, func(c argocdClusterFlags, name string, stdout io.Writer) error {
+			co := o
+			co.argocdCluster = c
+			co.cluster = name
+
+			return repeatGet(ctx, co, stdout)
+		})
+		if err != nil {
+			return err
+		}
+
+		return reportFanOutResults(os.Stdout, results, output)
+	}
+
+	fmt.Fprintf(os.Stderr, "Command %q does not exist\nAvailable commands:\n  get\n", cmd)
+	fs.Usage()
+
+	return nil
+}
+
+// repeatGetOptions holds the options of `repeat get`.
+type repeatGetOptions struct {
+	kubeconfigPath string
+	argocdCluster  argocdClusterFlags
+	// cluster is the name of the cluster included in the results when fanning out
+	cluster string
+
+	count    int
+	interval time.Duration
+	forever  bool
+
+	target              portForwardTarget
+	via                 string
+	allPods             bool
+	localPort           int
+	remotePort          int
+	healthCheckInterval time.Duration
+
+	url    string
+	print  bool
+	output string
+}
+
+// repeatGet repeatedly sends requests to the server and writes the results to stdout.
+func repeatGet(ctx context.Context, o repeatGetOptions, stdout io.Writer) error {
+	url := o.url
+
+	var err error
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+
+	var (
+		// forwarder is the port-forward to one of the pods, and pool is the port-forwards to all the pods with -all-pods
+		forwarder *portForwarder
+		pool      *portForwarderPool
+	)
+
+	switch o.via {
+	case viaAPIServerProxy:
+		restConfig, err := getClusterRestConfig(o.kubeconfigPath, o.argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		client, err = newAPIServerProxyClient(restConfig, o.target, o.remotePort)
+		if err != nil {
+			return err
+		}
+	case viaPortForward:
+		// forwarder requires rest config without argocd's custom transport
+		// hence we call getClusterRestConfig instead of getRestConfig
+		restConfig, err := getClusterRestConfig(o.kubeconfigPath, o.argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		if o.allPods {
+			pool, err = forwardToReadyPods(ctx, restConfig, o.target, o.localPort, o.remotePort, o.healthCheckInterval)
+			if err != nil {
+				return err
 			}
-			// forwarder requires rest config without argocd's custom transport
-			// hence we call getClusterRestConfig instead of getRestConfig
-			restConfig, err := getClusterRestConfig(kubeconfigPath, argocdClusterSecret)
+
+			defer pool.Close()
+		} else {
+			forwarder, err = newPortForwarder(restConfig, o.target, o.localPort, o.remotePort, o.healthCheckInterval)
 			if err != nil {
 				return err
 			}
-			ret, err := forwarder.WithRestConfig(context.Background(), options, restConfig)
+			if err := forwarder.Start(ctx); err != nil {
+				return err
+			}
+
+			defer forwarder.Close()
+		}
+	}
+
+	if o.localPort == 0 {
+		if pool != nil {
+			for _, f := range pool.Forwarders() {
+				log.Printf("Allocated local port %d for the port-forward to %s", f.LocalPort(), f.target)
+			}
+		}
+
+		if forwarder != nil {
+			log.Printf("Allocated local port %d for the port-forward to %s", forwarder.LocalPort(), forwarder.target)
+
+			url, err = forwardedURL(url, forwarder.LocalPort())
 			if err != nil {
 				return err
 			}
-			defer ret.Close()
-			_, err = ret.Ready()
+		}
+	}
+
+	// results holds the results of each pod with -all-pods, including the pods that are gone
+	var (
+		results  = []*podResult{}
+		resultOf = map[*portForwarder]*podResult{}
+	)
+
+	resultFor := func(f *portForwarder) *podResult {
+		r, ok := resultOf[f]
+		if !ok {
+			r = &podResult{Cluster: o.cluster, Pod: f.target.Pod, LocalPort: f.LocalPort()}
+			resultOf[f] = r
+			results = append(results, r)
+		}
+
+		return r
+	}
+
+	if pool != nil {
+		for _, f := range pool.Forwarders() {
+			resultFor(f)
+		}
+	}
+
+	var next int
+
+	var i int
+
+	for {
+		if !o.forever {
+			if i >= o.count {
+				break
+			}
+			i++
+		}
+
+		var (
+			fwd    = forwarder
+			result *podResult
+			reqURL = url
+		)
+
+		if pool != nil {
+			_, fwd = nextReadyPortForwarder(pool.Forwarders(), &next)
+			if fwd == nil {
+				log.Printf("No port-forwards are ready. Waiting for reconnection")
+				time.Sleep(o.interval)
+				continue
+			}
+
+			result = resultFor(fwd)
+
+			reqURL, err = forwardedURL(url, fwd.LocalPort())
 			if err != nil {
 				return err
 			}
 		}
 
-		client := &http.Client{
-			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		var body bytes.Buffer
+
+		var out io.Writer
+		if o.print {
+			out = &body
 		}
 
-		var i int
+		code, err := httpGet(client, reqURL, out)
+		if result != nil {
+			result.record(code, err)
+		}
 
-		for {
-			if !forever {
-				if i >= count {
-					break
-				}
-				i++
+		if o.output == outputJSON {
+			r := requestResult{Cluster: o.cluster, URL: reqURL, Code: code, Body: strings.TrimSuffix(body.String(), "\n")}
+			if fwd != nil {
+				r.Pod = fwd.currentPod()
+				r.LocalPort = fwd.LocalPort()
 			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			if err := json.NewEncoder(stdout).Encode(r); err != nil {
+				return err
+			}
+		} else if _, err := body.WriteTo(stdout); err != nil {
+			return err
+		}
 
-			if err := httpGet(client, url, print); err != nil {
+		if err != nil {
+			if fwd == nil {
 				return err
 			}
 
-			time.Sleep(interval)
+			if pool != nil {
+				log.Printf("Request to pod %s failed: %v", fwd.target.Pod, err)
+				fwd.RequestReconnect(reconnectReasonRequestFailed)
+			} else {
+				// The pod we were forwarding to might have gone away.
+				// Keep repeating over a new port-forward instead of failing.
+				log.Printf("Request failed: %v", err)
+
+				// Without -forever, give up when no pod becomes ready so that a -count run never hangs
+				reconnectCtx, cancelReconnect := ctx, context.CancelFunc(func() {})
+				if !o.forever {
+					reconnectCtx, cancelReconnect = context.WithTimeout(ctx, reconnectTimeout)
+				}
+
+				err := fwd.Reconnect(reconnectCtx, reconnectReasonRequestFailed)
+				cancelReconnect()
+
+				if err != nil {
+					return err
+				}
+			}
+
+			// Connections kept alive in the pool still point to the old forward
+			client.CloseIdleConnections()
 		}
 
-		return nil
+		time.Sleep(o.interval)
 	}
 
-	fmt.Fprintf(os.Stderr, "Command %q does not exist\nAvailable commands:\n  get\n", cmd)
-	fs.Usage()
+	if o.allPods {
+		if o.output == outputJSON {
+			return json.NewEncoder(stdout).Encode(results)
+		}
+
+		return printPodResults(stdout, results)
+	}
 
 	return nil
 }
@@ -174,49 +464,185 @@ func getFlags(fs *flag.FlagSet, args []string) (string, bool, error) {
 		return "", false, err
 	}
 
-	fmt.Fprintf(os.Stdout, "%v\n", fs.Args())
-
 	return url, print, nil
 }
 
 func get(args []string) error {
 	fs := flag.NewFlagSet("get", flag.ExitOnError)
 
+	var (
+		argocdCluster  argocdClusterFlags
+		namespace      string
+		service        string
+		pod            string
+		selector       string
+		remotePort     int
+		kubeconfigPath string
+		via            string
+		fanOutOpts     fanOutFlags
+	)
+
+	argocdCluster.register(fs)
+	rejectArgocdServer(fs)
+	fs.StringVar(&namespace, "namespace", "", "Namespace of the Kubernetes service or pod to access. Defaults to \"default\"")
+	fs.StringVar(&service, "service", "", "Name of the Kubernetes service that is connected to the pods, in the form of NAME or NAMESPACE/NAME. Required if you'd want access the app via Kubernetes port-forwarding or the API server proxy")
+	fs.StringVar(&pod, "pod", "", "Name of the Kubernetes pod to access, in the form of NAME or NAMESPACE/NAME. Can be used instead of -service")
+	fs.StringVar(&selector, "selector", "", "Label selector of the pods to port-forward to, like app=wy-serve. Can be used instead of -service")
+	fs.IntVar(&remotePort, "remote-port", 8080, "The pod port when port-forwarding, or the service port when accessing via the API server proxy")
+	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for port-forwarding and the API server proxy")
+	fs.StringVar(&via, "via", "", "How to reach the server. One of direct, port-forward, and apiserver-proxy. Defaults to port-forward when -service, -pod or -selector is specified, direct otherwise. Port-forwarding allocates a free local port and rewrites the host and the port of -url accordingly")
+	fanOutOpts.register(fs)
+
 	url, print, err := getFlags(fs, args)
 	if err != nil {
 		return err
 	}
 
+	target, err := newPortForwardTarget(namespace, service, pod, selector)
+	if err != nil {
+		return err
+	}
+
+	via, err = resolveVia(via, target)
+	if err != nil {
+		return err
+	}
+
+	if err := fanOutOpts.checkVia(via); err != nil {
+		return err
+	}
+
+	o := getOptions{
+		kubeconfigPath: kubeconfigPath,
+		argocdCluster:  argocdCluster,
+		target:         target,
+		via:            via,
+		remotePort:     remotePort,
+		url:            url,
+		print:          print,
+	}
+
+	if !fanOutOpts.enabled {
+		return getOnce(o, os.Stdout)
+	}
+
+	results, err := fanOut(os.Stdout, kubeconfigPath, argocdCluster, fanOutOpts.parallelism, outputText, func(c argocdClusterFlags, _ string, stdout io.Writer) error {
+		co := o
+		co.argocdCluster = c
+
+		return getOnce(co, stdout)
+	})
+	if err != nil {
+		return err
+	}
+
+	return reportFanOutResults(os.Stdout, results, outputText)
+}
+
+// getOptions holds the options of `get`.
+type getOptions struct {
+	kubeconfigPath string
+	argocdCluster  argocdClusterFlags
+
+	target     portForwardTarget
+	via        string
+	remotePort int
+
+	url   string
+	print bool
+}
+
+// getOnce sends a request to the server and writes the response body to stdout.
+func getOnce(o getOptions, stdout io.Writer) error {
 	client := &http.Client{
 		Transport: http.DefaultTransport.(*http.Transport).Clone(),
 	}
 
-	return httpGet(client, url, print)
+	url := o.url
+
+	switch o.via {
+	case viaAPIServerProxy:
+		restConfig, err := getClusterRestConfig(o.kubeconfigPath, o.argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		client, err = newAPIServerProxyClient(restConfig, o.target, o.remotePort)
+		if err != nil {
+			return err
+		}
+	case viaPortForward:
+		// See repeatGet for why we call getClusterRestConfig
+		restConfig, err := getClusterRestConfig(o.kubeconfigPath, o.argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		// A free local port, as the request is sent only once. No health checks for the same reason
+		forwarder, err := newPortForwarder(restConfig, o.target, 0, o.remotePort, 0)
+		if err != nil {
+			return err
+		}
+
+		if err := forwarder.Start(context.Background()); err != nil {
+			return err
+		}
+
+		defer forwarder.Close()
+
+		url, err = forwardedURL(url, forwarder.LocalPort())
+		if err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer
+	if o.print {
+		out = stdout
+	}
+
+	_, err := httpGet(client, url, out)
+
+	return err
 }
 
-func httpGet(client *http.Client, url string, print bool) error {
+// httpGet sends a GET request to the URL and returns the response status code.
+// The response body followed by a newline is written to out unless out is nil.
+func httpGet(client *http.Client, url string, out io.Writer) (int, error) {
 	req, err := http.NewRequest(http.MethodGet, url, bytes.NewBuffer(nil))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	res, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	defer res.Body.Close()
 
-	if print {
+	if out != nil {
 		all, err := io.ReadAll(res.Body)
 		if err != nil {
-			return err
+			return res.StatusCode, err
 		}
 
-		fmt.Fprintf(os.Stdout, string(all)+"\n")
+		fmt.Fprintln(out, string(all))
 	}
 
-	return nil
+	return res.StatusCode, nil
+}
+
+// forwardedURL returns the URL with its host and port replaced with localhost and the given local port.
+func forwardedURL(rawURL string, port int) (string, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Host = net.JoinHostPort("localhost", strconv.Itoa(port))
+
+	return u.String(), nil
 }
 
 func serve(args []string) error {
@@ -308,32 +734,99 @@ func serve(args []string) error {
 }
 
 func print(args []string) error {
-	if args[0] != "kubeconfig" {
-		return fmt.Errorf("the only supported print sub-command is \"kubeconfig\", but you provided %q", args[0])
+	if len(args) > 0 && args[0] == "cluster-secret" {
+		return printClusterSecret(args[1:])
+	}
+
+	if len(args) == 0 || args[0] != "kubeconfig" {
+		return fmt.Errorf("the supported print sub-commands are \"kubeconfig\" and \"cluster-secret\", but you provided %v", args)
 	}
 
 	args = args[1:]
 
 	var (
-		argocdClusterSecret string
-		kubeconfigPath      string
-		setNamespace        string
+		argocdCluster  argocdClusterFlags
+		kubeconfigPath string
+		setNamespace   string
+		outputDir      string
+		fanOutOpts     fanOutFlags
+		all            bool
+		mergeInto      string
 	)
 
 	fs := flag.NewFlagSet(fmt.Sprintf("%s-print-kubeconfig", appName), flag.ExitOnError)
-	fs.StringVar(&argocdClusterSecret, "argocd-cluster-secret", "", "Name of the Kubernetes secret that contains an ArgoCD-style cluster connection info. If specified, it uses port-forwarding to access the target server")
+	argocdCluster.register(fs)
+	rejectArgocdServer(fs)
 	fs.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file for port-forwarding")
 	fs.StringVar(&setNamespace, "set-namespace", "default", "Namespace to be set in the default context of the generated kubeconfig")
+	fs.StringVar(&outputDir, "output-dir", "", "Directory to write the kubeconfig file of each cluster to, named CLUSTER_SECRET_NAME.kubeconfig. Required by -fan-out")
+	fanOutOpts.register(fs)
+	fs.BoolVar(&all, "all", false, "Generate a kubeconfig that has a cluster, a user and a context for every ArgoCD cluster in -cluster-source that matches -argocd-cluster and -argocd-cluster-selector, if any. The names are derived from the cluster names")
+	fs.StringVar(&mergeInto, "merge-into", "", "Path to the kubeconfig file to merge the generated cluster, user and context into, instead of printing to stdout. The file is created if it doesn't exist")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	if argocdClusterSecret == "" {
-		return fmt.Errorf("missing value for the required flag %s", "-argocd-cluster-secret")
+	if all || mergeInto != "" {
+		config := clientcmdapi.NewConfig()
+
+		if mergeInto != "" {
+			if _, err := os.Stat(mergeInto); err == nil {
+				config, err = clientcmd.LoadFromFile(mergeInto)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := getMergedKubeconfig(kubeconfigPath, argocdCluster, all, setNamespace, config); err != nil {
+			return err
+		}
+
+		if mergeInto != "" {
+			return clientcmd.WriteToFile(*config, mergeInto)
+		}
+
+		kubeconfigData, err := clientcmd.Write(*config)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(kubeconfigData)
+
+		return err
+	}
+
+	if argocdCluster.isZero() {
+		return fmt.Errorf("missing value for the required flag %s, %s or %s", "-argocd-cluster-secret", "-argocd-cluster", "-argocd-cluster-selector")
+	}
+
+	if fanOutOpts.enabled {
+		if outputDir == "" {
+			return fmt.Errorf("missing value for the flag %s required by %s", "-output-dir", "-fan-out")
+		}
+
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return err
+		}
+
+		results, err := fanOut(os.Stdout, kubeconfigPath, argocdCluster, fanOutOpts.parallelism, outputText, func(c argocdClusterFlags, name string, _ io.Writer) error {
+			kubeconfigData, err := getKubeconfig(kubeconfigPath, c, setNamespace)
+			if err != nil {
+				return err
+			}
+
+			return os.WriteFile(filepath.Join(outputDir, name+".kubeconfig"), kubeconfigData, 0600)
+		})
+		if err != nil {
+			return err
+		}
+
+		return reportFanOutResults(os.Stdout, results, outputText)
 	}
 
-	kubeconfigData, err := getKubeconfig(kubeconfigPath, argocdClusterSecret, setNamespace)
+	kubeconfigData, err := getKubeconfig(kubeconfigPath, argocdCluster, setNamespace)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,112 @@
+package argocd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIClient fetches clusters from the ArgoCD API server, authenticated with an ArgoCD auth token.
+//
+// Unlike the cluster secrets, it requires no Kubernetes RBAC.
+// The API server redacts the credentials in the cluster config, so the clusters can't be used to connect to the clusters.
+type APIClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// APIError is an error response from the ArgoCD API server.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ArgoCD API server responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("ArgoCD API server responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// NewAPIClient returns a client of the ArgoCD API server.
+// The server is either a URL or HOST[:PORT] like the argocd CLI's --server, in which case https is assumed.
+func NewAPIClient(server, token string, insecure bool) (*APIClient, error) {
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		server = "https://" + server
+	}
+
+	if _, err := url.Parse(server); err != nil {
+		return nil, fmt.Errorf("invalid ArgoCD API server %q: %w", server, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &APIClient{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+	}, nil
+}
+
+// ListClusters returns all the clusters registered to ArgoCD that the token is allowed to get.
+func (c *APIClient) ListClusters(ctx context.Context) ([]Cluster, error) {
+	var list ClusterList
+
+	if err := c.get(ctx, "/api/v1/clusters", &list); err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+func (c *APIClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+
+		_ = json.Unmarshal(body, &e)
+
+		return &APIError{StatusCode: res.StatusCode, Message: e.Message}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding the response from %s: %w", req.URL, err)
+	}
+
+	return nil
+}
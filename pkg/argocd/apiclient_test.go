@@ -0,0 +1,129 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIClientListClusters(t *testing.T) {
+	testcases := []struct {
+		name        string
+		token       string
+		status      int
+		body        string
+		wantServers []string
+		wantErr     string
+		wantStatus  int
+	}{
+		{
+			name:        "clusters",
+			token:       "token",
+			status:      http.StatusOK,
+			body:        `{"items":[{"name":"in-cluster","server":"https://kubernetes.default.svc"},{"name":"prod","server":"https://prod.example.com","config":{"tlsClientConfig":{"insecure":false}}}]}`,
+			wantServers: []string{"https://kubernetes.default.svc", "https://prod.example.com"},
+		},
+		{
+			name:   "no clusters",
+			token:  "token",
+			status: http.StatusOK,
+			body:   `{}`,
+		},
+		{
+			name:       "invalid token",
+			token:      "invalid",
+			wantErr:    "ArgoCD API server responded with 401 Unauthorized: invalid session",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "error without message",
+			token:      "token",
+			status:     http.StatusInternalServerError,
+			body:       `oops`,
+			wantErr:    "ArgoCD API server responded with 500 Internal Server Error",
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:    "invalid response",
+			token:   "token",
+			status:  http.StatusOK,
+			body:    `<html></html>`,
+			wantErr: "decoding the response from",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/clusters" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					_, _ = w.Write([]byte(`{"error":"invalid session","code":16,"message":"invalid session"}`))
+					return
+				}
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			// HOST:PORT like the argocd CLI's --server, which defaults to https
+			c, err := NewAPIClient(strings.TrimPrefix(srv.URL, "https://"), tc.token, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clusters, err := c.ListClusters(context.Background())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				var apiErr *APIError
+				if tc.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tc.wantStatus) {
+					t.Errorf("unexpected API error: want status %d, got %v", tc.wantStatus, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var servers []string
+			for _, c := range clusters {
+				servers = append(servers, c.Server)
+			}
+
+			if strings.Join(servers, ",") != strings.Join(tc.wantServers, ",") {
+				t.Errorf("unexpected servers: want %v, got %v", tc.wantServers, servers)
+			}
+		})
+	}
+}
+
+func TestAPIClientVerifiesServerCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewAPIClient(srv.URL, "token", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ListClusters(context.Background()); err == nil {
+		t.Error("expected an error for the self-signed certificate without insecure")
+	}
+}
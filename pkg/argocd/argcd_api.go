@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -135,6 +136,9 @@ type AWSAuthConfig struct {
 
 	// RoleARN contains optional role ARN. If set then AWS IAM Authenticator assume a role to perform cluster operations instead of the default AWS credential provider chain.
 	RoleARN string `json:"roleARN,omitempty" protobuf:"bytes,2,opt,name=roleARN"`
+
+	// Profile contains optional AWS profile. If set then AWS IAM Authenticator uses this profile to perform cluster operations instead of the default AWS credential provider chain.
+	Profile string `json:"profile,omitempty" protobuf:"bytes,3,opt,name=profile"`
 }
 
 // ExecProviderConfig is config used to call an external command to perform cluster authentication
@@ -176,6 +180,12 @@ type ClusterConfig struct {
 
 	// ExecProviderConfig contains configuration for an exec provider
 	ExecProviderConfig *ExecProviderConfig `json:"execProviderConfig,omitempty" protobuf:"bytes,6,opt,name=execProviderConfig"`
+
+	// DisableCompression bypasses automatic GZip compression requests to the server.
+	DisableCompression bool `json:"disableCompression,omitempty" protobuf:"bytes,7,opt,name=disableCompression"`
+
+	// ProxyURL is the URL to the proxy to be used for all requests send to the server
+	ProxyUrl string `json:"proxyUrl,omitempty" protobuf:"bytes,8,opt,name=proxyUrl"`
 }
 
 // TLSClientConfig contains settings to enable transport layer security
@@ -210,8 +220,12 @@ func SetK8SConfigDefaults(config *rest.Config) error {
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}).DialContext
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = config.Proxy
+	}
 	transport := utilnet.SetTransportDefaults(&http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
+		Proxy:               proxy,
 		TLSHandshakeTimeout: 10 * time.Second,
 		TLSClientConfig:     tlsConfig,
 		MaxIdleConns:        K8sMaxIdleConnections,
@@ -268,13 +282,21 @@ func (c *Cluster) RawRestConfig() *rest.Config {
 			if c.Config.AWSAuthConfig.RoleARN != "" {
 				args = append(args, "--role-arn", c.Config.AWSAuthConfig.RoleARN)
 			}
+			var env []api.ExecEnvVar
+			if c.Config.AWSAuthConfig.Profile != "" {
+				env = append(env, api.ExecEnvVar{
+					Name:  "AWS_PROFILE",
+					Value: c.Config.AWSAuthConfig.Profile,
+				})
+			}
 			config = &rest.Config{
 				Host:            c.Server,
 				TLSClientConfig: tlsClientConfig,
 				ExecProvider: &api.ExecConfig{
-					APIVersion: "client.authentication.k8s.io/v1alpha1",
+					APIVersion: ExecAPIVersionV1Beta1,
 					Command:    "aws",
 					Args:       args,
+					Env:        env,
 				},
 			}
 		} else if c.Config.ExecProviderConfig != nil {
@@ -291,7 +313,7 @@ func (c *Cluster) RawRestConfig() *rest.Config {
 				Host:            c.Server,
 				TLSClientConfig: tlsClientConfig,
 				ExecProvider: &api.ExecConfig{
-					APIVersion:  c.Config.ExecProviderConfig.APIVersion,
+					APIVersion:  SupportedExecAPIVersion(c.Config.ExecProviderConfig.APIVersion),
 					Command:     c.Config.ExecProviderConfig.Command,
 					Args:        c.Config.ExecProviderConfig.Args,
 					Env:         env,
@@ -308,6 +330,16 @@ func (c *Cluster) RawRestConfig() *rest.Config {
 			}
 		}
 	}
+	if err == nil && c.Server != KubernetesInternalAPIServerAddr {
+		config.DisableCompression = c.Config.DisableCompression
+		if c.Config.ProxyUrl != "" {
+			var proxyURL *url.URL
+			proxyURL, err = url.Parse(c.Config.ProxyUrl)
+			if err == nil {
+				config.Proxy = http.ProxyURL(proxyURL)
+			}
+		}
+	}
 	if err != nil {
 		panic(fmt.Sprintf("Unable to create K8s REST config: %v", err))
 	}
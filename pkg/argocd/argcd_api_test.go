@@ -0,0 +1,115 @@
+package argocd
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRawRestConfig(t *testing.T) {
+	testcases := []struct {
+		name     string
+		config   ClusterConfig
+		wantExec *clientcmdapi.ExecConfig
+	}{
+		{
+			name: "bearer token",
+			config: ClusterConfig{
+				BearerToken: "token",
+			},
+		},
+		{
+			name: "awsAuthConfig with profile",
+			config: ClusterConfig{
+				AWSAuthConfig: &AWSAuthConfig{ClusterName: "prod", RoleARN: "arn:aws:iam::123456789012:role/argocd", Profile: "prod"},
+			},
+			wantExec: &clientcmdapi.ExecConfig{
+				APIVersion: ExecAPIVersionV1Beta1,
+				Command:    "aws",
+				Args:       []string{"eks", "get-token", "--cluster-name", "prod", "--role-arn", "arn:aws:iam::123456789012:role/argocd"},
+				Env:        []clientcmdapi.ExecEnvVar{{Name: "AWS_PROFILE", Value: "prod"}},
+			},
+		},
+		{
+			name: "awsAuthConfig without profile",
+			config: ClusterConfig{
+				AWSAuthConfig: &AWSAuthConfig{ClusterName: "prod"},
+			},
+			wantExec: &clientcmdapi.ExecConfig{
+				APIVersion: ExecAPIVersionV1Beta1,
+				Command:    "aws",
+				Args:       []string{"eks", "get-token", "--cluster-name", "prod"},
+			},
+		},
+		{
+			name: "execProviderConfig with v1",
+			config: ClusterConfig{
+				ExecProviderConfig: &ExecProviderConfig{Command: "gke-gcloud-auth-plugin", APIVersion: ExecAPIVersionV1},
+			},
+			wantExec: &clientcmdapi.ExecConfig{
+				APIVersion: ExecAPIVersionV1Beta1,
+				Command:    "gke-gcloud-auth-plugin",
+			},
+		},
+		{
+			name: "execProviderConfig with v1alpha1",
+			config: ClusterConfig{
+				ExecProviderConfig: &ExecProviderConfig{Command: "kubelogin", APIVersion: ExecAPIVersionV1Alpha1},
+			},
+			wantExec: &clientcmdapi.ExecConfig{
+				APIVersion: ExecAPIVersionV1Alpha1,
+				Command:    "kubelogin",
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		for _, proxy := range []string{"", "http://proxy.example.com:3128"} {
+			for _, disableCompression := range []bool{false, true} {
+				config := tc.config
+				config.ProxyUrl = proxy
+				config.DisableCompression = disableCompression
+
+				c := &Cluster{Server: "https://10.0.0.1:6443", Config: config}
+
+				restConfig := c.RawRestConfig()
+
+				if !reflect.DeepEqual(restConfig.ExecProvider, tc.wantExec) {
+					t.Errorf("%s: unexpected exec config:\nwant %+v\ngot  %+v", tc.name, tc.wantExec, restConfig.ExecProvider)
+				}
+
+				if restConfig.DisableCompression != disableCompression {
+					t.Errorf("%s: unexpected DisableCompression: want %v, got %v", tc.name, disableCompression, restConfig.DisableCompression)
+				}
+
+				if proxy == "" {
+					if restConfig.Proxy != nil {
+						t.Errorf("%s: unexpected proxy", tc.name)
+					}
+
+					continue
+				}
+
+				if restConfig.Proxy == nil {
+					t.Fatalf("%s: the proxy %s isn't set", tc.name, proxy)
+				}
+
+				req, err := http.NewRequest(http.MethodGet, c.Server+"/version", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				u, err := restConfig.Proxy(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if u == nil || u.String() != proxy {
+					t.Errorf("%s: unexpected proxy: want %s, got %v", tc.name, proxy, u)
+				}
+			}
+		}
+	}
+}
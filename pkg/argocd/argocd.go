@@ -13,6 +13,16 @@ import (
 	"k8s.io/utils/pointer"
 )
 
+const (
+	// LabelKeySecretType contains the type of argocd secret (currently: 'cluster', 'repository', 'repo-config' or 'repo-creds')
+	// Copied from https://github.com/argoproj/argo-cd/blob/3c874ae065c14102003d041d76d4a337abd72f1e/common/common.go#L107-L108
+	LabelKeySecretType = "argocd.argoproj.io/secret-type"
+
+	// LabelValueSecretTypeCluster indicates a secret type of cluster
+	// Copied from https://github.com/argoproj/argo-cd/blob/3c874ae065c14102003d041d76d4a337abd72f1e/common/common.go#L109-L110
+	LabelValueSecretTypeCluster = "cluster"
+)
+
 // SecretToCluster converts a secret into a Cluster object
 // Derived from https://github.com/argoproj/argo-cd/blob/2147ed3aea727ba128df629d53a1d25fd0f6927c/util/db/cluster.go#L290
 func SecretToCluster(s *corev1.Secret) (*Cluster, error) {
@@ -22,10 +32,6 @@ func SecretToCluster(s *corev1.Secret) (*Cluster, error) {
 		// Copied from https://github.com/argoproj/argo-cd/blob/cc4eea0d6951f1025c9ebb487374658186fa8984/pkg/apis/application/v1alpha1/application_annotations.go#L4-L6
 		AnnotationKeyRefresh string = "argocd.argoproj.io/refresh"
 
-		// LabelKeySecretType contains the type of argocd secret (currently: 'cluster', 'repository', 'repo-config' or 'repo-creds')
-		// Copied from https://github.com/argoproj/argo-cd/blob/3c874ae065c14102003d041d76d4a337abd72f1e/common/common.go#L107-L108
-		LabelKeySecretType = "argocd.argoproj.io/secret-type"
-
 		// AnnotationKeyManagedBy is annotation name which indicates that k8s resource is managed by an application.
 		// Copied from https://github.com/argoproj/argo-cd/blob/3c874ae065c14102003d041d76d4a337abd72f1e/common/common.go#L122-L123
 		AnnotationKeyManagedBy = "managed-by"
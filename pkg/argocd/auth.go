@@ -0,0 +1,41 @@
+package argocd
+
+// Authentication methods used to connect to a cluster
+const (
+	AuthMethodInCluster = "in-cluster"
+	AuthMethodBearer    = "bearer"
+	AuthMethodBasic     = "basic"
+	AuthMethodTLS       = "tls"
+	AuthMethodAWS       = "aws"
+	AuthMethodExec      = "exec"
+)
+
+// AuthMethods returns the authentication methods that RawRestConfig uses to connect to the cluster.
+// It never includes the credentials themselves, so that the result can be safely printed.
+func (c *Cluster) AuthMethods() []string {
+	var methods []string
+
+	if c.Server == KubernetesInternalAPIServerAddr {
+		methods = append(methods, AuthMethodInCluster)
+	} else if c.Config.AWSAuthConfig != nil {
+		methods = append(methods, AuthMethodAWS)
+	} else if c.Config.ExecProviderConfig != nil {
+		methods = append(methods, AuthMethodExec)
+	}
+
+	if len(methods) == 0 || methods[0] == AuthMethodInCluster {
+		if c.Config.BearerToken != "" {
+			methods = append(methods, AuthMethodBearer)
+		}
+
+		if c.Config.Username != "" || c.Config.Password != "" {
+			methods = append(methods, AuthMethodBasic)
+		}
+	}
+
+	if c.Server != KubernetesInternalAPIServerAddr && len(c.Config.TLSClientConfig.CertData) > 0 {
+		methods = append(methods, AuthMethodTLS)
+	}
+
+	return methods
+}
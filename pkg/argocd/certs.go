@@ -0,0 +1,67 @@
+package argocd
+
+import (
+	"time"
+)
+
+// Kinds of certificates in the cluster config
+const (
+	CertKindCA     = "ca"
+	CertKindClient = "client"
+)
+
+// CertInfo is the subset of a certificate in the cluster config that is safe to print.
+type CertInfo struct {
+	// Kind is either CertKindCA for TLSClientConfig.CAData or CertKindClient for TLSClientConfig.CertData
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// Certificates decodes the CA and client certificates in the cluster config.
+// It fails when CAData or CertData is set but contains no valid PEM-encoded certificate.
+func (c *Cluster) Certificates() ([]CertInfo, error) {
+	var infos []CertInfo
+
+	for _, d := range []struct {
+		kind string
+		data []byte
+	}{
+		{CertKindCA, c.Config.TLSClientConfig.CAData},
+		{CertKindClient, c.Config.TLSClientConfig.CertData},
+	} {
+		if len(d.data) == 0 {
+			continue
+		}
+
+		certs, err := parseCertificates(d.data)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cert := range certs {
+			sans := append([]string{}, cert.DNSNames...)
+			for _, ip := range cert.IPAddresses {
+				sans = append(sans, ip.String())
+			}
+			for _, u := range cert.URIs {
+				sans = append(sans, u.String())
+			}
+			sans = append(sans, cert.EmailAddresses...)
+
+			infos = append(infos, CertInfo{
+				Kind:      d.kind,
+				Subject:   cert.Subject.String(),
+				Issuer:    cert.Issuer.String(),
+				SANs:      sans,
+				NotBefore: cert.NotBefore,
+				NotAfter:  cert.NotAfter,
+			})
+		}
+	}
+
+	return infos, nil
+}
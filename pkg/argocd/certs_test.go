@@ -0,0 +1,145 @@
+package argocd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCAAndClientCertificates returns a CA certificate and a client certificate signed by the CA, both PEM-encoded.
+func testCAAndClientCertificates(t *testing.T, caNotAfter, clientNotAfter time.Time) (string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes-ca"},
+		NotBefore:             caNotAfter.Add(-24 * time.Hour),
+		NotAfter:              caNotAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "admin", Organization: []string{"system:masters"}},
+		NotBefore:    clientNotAfter.Add(-24 * time.Hour),
+		NotAfter:     clientNotAfter,
+		DNSNames:     []string{"admin.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	clientDER, err := x509.CreateCertificate(rand.Reader, client, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}))
+}
+
+func TestCertificates(t *testing.T) {
+	caNotAfter := time.Date(2033, 6, 1, 0, 0, 0, 0, time.UTC)
+	clientNotAfter := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	ca, client := testCAAndClientCertificates(t, caNotAfter, clientNotAfter)
+
+	caInfo := CertInfo{
+		Kind:      CertKindCA,
+		Subject:   "CN=kubernetes-ca",
+		Issuer:    "CN=kubernetes-ca",
+		SANs:      []string{},
+		NotBefore: caNotAfter.Add(-24 * time.Hour),
+		NotAfter:  caNotAfter,
+	}
+
+	clientInfo := CertInfo{
+		Kind:      CertKindClient,
+		Subject:   "CN=admin,O=system:masters",
+		Issuer:    "CN=kubernetes-ca",
+		SANs:      []string{"admin.example.com", "10.0.0.1"},
+		NotBefore: clientNotAfter.Add(-24 * time.Hour),
+		NotAfter:  clientNotAfter,
+	}
+
+	testcases := []struct {
+		name    string
+		tls     TLSClientConfig
+		want    []CertInfo
+		wantErr bool
+	}{
+		{
+			name: "no certificates",
+			tls:  TLSClientConfig{Insecure: true},
+		},
+		{
+			name: "CA only",
+			tls:  TLSClientConfig{CAData: []byte(ca)},
+			want: []CertInfo{caInfo},
+		},
+		{
+			name: "CA and client",
+			tls:  TLSClientConfig{CAData: []byte(ca), CertData: []byte(client)},
+			want: []CertInfo{caInfo, clientInfo},
+		},
+		{
+			name: "bundle in CAData",
+			tls:  TLSClientConfig{CAData: []byte(ca + client)},
+			want: []CertInfo{caInfo, func() CertInfo { c := clientInfo; c.Kind = CertKindCA; return c }()},
+		},
+		{
+			name:    "invalid CAData",
+			tls:     TLSClientConfig{CAData: []byte("not a certificate")},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Cluster{Config: ClusterConfig{TLSClientConfig: tc.tls}}
+
+			got, err := c.Certificates()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected certificates:\nwant %+v\ngot  %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package argocd
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// CheckConnection connects to the cluster with the config and populates Info.ServerVersion, Info.APIVersions and Info.ConnectionState.
+// The deprecated ServerVersion and ConnectionState fields are populated as well, like ArgoCD does.
+//
+// The connection status is Unknown when the config is unusable hence no connection was attempted,
+// Failed when the API server couldn't be reached or rejected the request, and Successful otherwise.
+func (c *Cluster) CheckConnection(config *rest.Config) {
+	state := checkConnection(config, &c.Info)
+
+	c.Info.ConnectionState = state
+	c.ConnectionState = state
+	c.ServerVersion = c.Info.ServerVersion
+}
+
+func checkConnection(config *rest.Config, info *ClusterInfo) ConnectionState {
+	now := metav1.Now()
+
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return ConnectionState{
+			Status:     ConnectionStatusUnknown,
+			Message:    err.Error(),
+			ModifiedAt: &now,
+		}
+	}
+
+	version, err := client.ServerVersion()
+	if err != nil {
+		return ConnectionState{
+			Status:     ConnectionStatusFailed,
+			Message:    err.Error(),
+			ModifiedAt: &now,
+		}
+	}
+
+	info.ServerVersion = version.String()
+
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return ConnectionState{
+			Status:     ConnectionStatusFailed,
+			Message:    err.Error(),
+			ModifiedAt: &now,
+		}
+	}
+
+	info.APIVersions = nil
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			info.APIVersions = append(info.APIVersions, v.GroupVersion)
+		}
+	}
+
+	return ConnectionState{
+		Status:     ConnectionStatusSuccessful,
+		ModifiedAt: &now,
+	}
+}
@@ -0,0 +1,24 @@
+package argocd
+
+import "github.com/mumoshu/wy/execcredential"
+
+// API versions of the ExecCredential exchanged with exec credential plugins
+const (
+	ExecAPIVersionV1Alpha1 = execcredential.APIVersionV1Alpha1
+	ExecAPIVersionV1Beta1  = execcredential.APIVersionV1Beta1
+	ExecAPIVersionV1       = execcredential.APIVersionV1
+)
+
+// SupportedExecAPIVersion returns the ExecCredential API version that the client-go used by wy
+// should request to the exec credential plugin configured with apiVersion.
+//
+// ArgoCD accepts v1 in execProviderConfig, but our client-go supports only up to v1beta1.
+// v1 is requested as v1beta1 instead, because the status of the ExecCredential is the same in both versions
+// and the plugins that support v1 also support v1beta1, like gke-gcloud-auth-plugin and kubelogin.
+func SupportedExecAPIVersion(apiVersion string) string {
+	if apiVersion == ExecAPIVersionV1 {
+		return ExecAPIVersionV1Beta1
+	}
+
+	return apiVersion
+}
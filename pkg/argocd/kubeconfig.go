@@ -0,0 +1,78 @@
+package argocd
+
+import (
+	"net/http"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultKubeConfigEntryName is the name of the cluster, the user and the context in the kubeconfig generated by GenerateKubeConfiguration.
+const defaultKubeConfigEntryName = "default"
+
+// GenerateKubeConfiguration returns a kubeconfig that has a cluster, a user and a context to connect to the cluster with the rest config.
+// The context is the current context, and defaults to the namespace.
+func GenerateKubeConfiguration(restConfig *rest.Config, namespace string) ([]byte, error) {
+	config := clientcmdapi.NewConfig()
+
+	AddToKubeConfig(config, defaultKubeConfigEntryName, restConfig, namespace)
+
+	config.CurrentContext = defaultKubeConfigEntryName
+
+	return clientcmd.Write(*config)
+}
+
+// AddToKubeConfig adds a cluster, a user and a context, all named name, to the kubeconfig.
+// The context connects to the cluster with the rest config, and defaults to the namespace.
+// Existing entries with the same name are overwritten.
+func AddToKubeConfig(config *clientcmdapi.Config, name string, restConfig *rest.Config, namespace string) {
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = restConfig.Host
+	cluster.TLSServerName = restConfig.ServerName
+	cluster.InsecureSkipTLSVerify = restConfig.Insecure
+	cluster.CertificateAuthority = restConfig.CAFile
+	cluster.CertificateAuthorityData = restConfig.CAData
+	cluster.ProxyURL = proxyURL(restConfig)
+
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.ClientCertificate = restConfig.CertFile
+	authInfo.ClientCertificateData = restConfig.CertData
+	authInfo.ClientKey = restConfig.KeyFile
+	authInfo.ClientKeyData = restConfig.KeyData
+	authInfo.Token = restConfig.BearerToken
+	authInfo.TokenFile = restConfig.BearerTokenFile
+	authInfo.Username = restConfig.Username
+	authInfo.Password = restConfig.Password
+	authInfo.Exec = restConfig.ExecProvider
+	authInfo.AuthProvider = restConfig.AuthProvider
+
+	context := clientcmdapi.NewContext()
+	context.Cluster = name
+	context.AuthInfo = name
+	context.Namespace = namespace
+
+	config.Clusters[name] = cluster
+	config.AuthInfos[name] = authInfo
+	config.Contexts[name] = context
+}
+
+// proxyURL returns the URL of the proxy the rest config uses to connect to the server, or an empty string if there's none.
+// The proxy from the environment is not taken into account, as it isn't a part of the cluster config.
+func proxyURL(restConfig *rest.Config) string {
+	if restConfig.Proxy == nil {
+		return ""
+	}
+
+	req, err := http.NewRequest(http.MethodGet, restConfig.Host, nil)
+	if err != nil {
+		return ""
+	}
+
+	u, err := restConfig.Proxy(req)
+	if err != nil || u == nil {
+		return ""
+	}
+
+	return u.String()
+}
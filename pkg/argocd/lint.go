@@ -0,0 +1,264 @@
+package argocd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Severities of lint findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a problem found in an ArgoCD cluster secret.
+type Finding struct {
+	// Secret is the name of the secret in the form of NAMESPACE/NAME, or NAME when the namespace is unknown
+	Secret string `json:"secret"`
+	// Field is the key in the secret's data or metadata, or the field in the config, that has the problem
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// knownSecretKeys are the keys in the cluster secret's data that SecretToCluster reads.
+var knownSecretKeys = map[string]bool{
+	"server":           true,
+	"name":             true,
+	"config":           true,
+	"namespaces":       true,
+	"clusterResources": true,
+	"project":          true,
+	"shard":            true,
+}
+
+// LintSecret validates the ArgoCD cluster secret without connecting to the cluster.
+// Unlike SecretToCluster, that prints some of the problems to stderr and silently accepts the others,
+// it returns every problem found as a finding.
+// Client certificates are considered expired when they are not valid at now.
+func LintSecret(s *corev1.Secret, now time.Time) []Finding {
+	var findings []Finding
+
+	secret := s.Name
+	if s.Namespace != "" {
+		secret = s.Namespace + "/" + s.Name
+	}
+
+	add := func(field, severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Secret:   secret,
+			Field:    field,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if v := s.Labels[LabelKeySecretType]; v != LabelValueSecretTypeCluster {
+		add("metadata.labels", SeverityWarning, "label %s=%s is missing, so ArgoCD ignores the secret", LabelKeySecretType, LabelValueSecretTypeCluster)
+	}
+
+	if v, ok := s.Annotations["argocd.argoproj.io/refresh"]; ok {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			add("metadata.annotations", SeverityWarning, "invalid refresh annotation: %v", err)
+		}
+	}
+
+	var unknownKeys []string
+	for k := range s.Data {
+		if !knownSecretKeys[k] {
+			unknownKeys = append(unknownKeys, k)
+		}
+	}
+	sort.Strings(unknownKeys)
+	for _, k := range unknownKeys {
+		add(k, SeverityWarning, "unknown field")
+	}
+
+	server := string(s.Data["server"])
+	if server == "" {
+		add("server", SeverityError, "server is missing")
+	} else if u, err := url.Parse(server); err != nil {
+		add("server", SeverityError, "invalid server URL: %v", err)
+	} else if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		add("server", SeverityError, "invalid server URL %q: it must be in the form of https://HOST[:PORT]", server)
+	} else if u.Scheme == "http" {
+		add("server", SeverityWarning, "server is not using https")
+	}
+
+	if v, ok := s.Data["shard"]; ok {
+		if shard, err := strconv.Atoi(string(v)); err != nil {
+			add("shard", SeverityError, "invalid shard: %v", err)
+		} else if shard < 0 {
+			add("shard", SeverityError, "invalid shard %d: it must not be negative", shard)
+		}
+	}
+
+	if v, ok := s.Data["clusterResources"]; ok && string(v) != "true" && string(v) != "false" {
+		add("clusterResources", SeverityWarning, "clusterResources is %q, that is treated as false. It must be either true or false", string(v))
+	}
+
+	data, ok := s.Data["config"]
+	if !ok || len(data) == 0 {
+		add("config", SeverityWarning, "config is missing, so ArgoCD connects to the cluster without credentials")
+		return findings
+	}
+
+	var config ClusterConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		add("config", SeverityError, "malformed config: %v", err)
+		return findings
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ClusterConfig{}); err != nil {
+		add("config", SeverityWarning, "%v", err)
+	}
+
+	findings = append(findings, lintClusterConfig(secret, server, config, now)...)
+
+	return findings
+}
+
+func lintClusterConfig(secret, server string, c ClusterConfig, now time.Time) []Finding {
+	var findings []Finding
+
+	add := func(field, severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Secret:   secret,
+			Field:    "config." + field,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	tlsConfig := c.TLSClientConfig
+
+	if len(tlsConfig.CAData) > 0 {
+		if _, err := parseCertificates(tlsConfig.CAData); err != nil {
+			add("tlsClientConfig.caData", SeverityError, "%v", err)
+		}
+
+		if tlsConfig.Insecure {
+			add("tlsClientConfig.insecure", SeverityWarning, "insecure is true, so caData is not used to verify the server")
+		}
+	}
+
+	if len(tlsConfig.CertData) > 0 {
+		if certs, err := parseCertificates(tlsConfig.CertData); err != nil {
+			add("tlsClientConfig.certData", SeverityError, "%v", err)
+		} else if cert := certs[0]; now.After(cert.NotAfter) {
+			add("tlsClientConfig.certData", SeverityError, "client certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+		} else if now.Before(cert.NotBefore) {
+			add("tlsClientConfig.certData", SeverityError, "client certificate is not valid until %s", cert.NotBefore.Format(time.RFC3339))
+		}
+	}
+
+	if len(tlsConfig.KeyData) > 0 {
+		if block, _ := pem.Decode(tlsConfig.KeyData); block == nil {
+			add("tlsClientConfig.keyData", SeverityError, "no PEM data found")
+		}
+	}
+
+	switch {
+	case len(tlsConfig.CertData) > 0 && len(tlsConfig.KeyData) == 0:
+		add("tlsClientConfig.keyData", SeverityError, "keyData is missing while certData is set")
+	case len(tlsConfig.CertData) == 0 && len(tlsConfig.KeyData) > 0:
+		add("tlsClientConfig.certData", SeverityError, "certData is missing while keyData is set")
+	case len(tlsConfig.CertData) > 0 && len(tlsConfig.KeyData) > 0:
+		if _, err := tls.X509KeyPair(tlsConfig.CertData, tlsConfig.KeyData); err != nil {
+			add("tlsClientConfig", SeverityError, "invalid client certificate and key pair: %v", err)
+		}
+	}
+
+	// See RawRestConfig for which auth method takes precedence
+	if server != KubernetesInternalAPIServerAddr {
+		if c.AWSAuthConfig != nil && c.ExecProviderConfig != nil {
+			add("execProviderConfig", SeverityError, "awsAuthConfig and execProviderConfig are mutually exclusive. execProviderConfig is ignored")
+		}
+
+		if c.AWSAuthConfig != nil || c.ExecProviderConfig != nil {
+			if c.BearerToken != "" {
+				add("bearerToken", SeverityError, "bearerToken is ignored when awsAuthConfig or execProviderConfig is set")
+			}
+
+			if c.Username != "" || c.Password != "" {
+				add("username", SeverityError, "username and password are ignored when awsAuthConfig or execProviderConfig is set")
+			}
+		}
+	}
+
+	if c.BearerToken != "" && (c.Username != "" || c.Password != "") {
+		add("bearerToken", SeverityWarning, "bearerToken and basic auth are both set. Only one of them should be used")
+	}
+
+	if c.ProxyUrl != "" {
+		if u, err := url.Parse(c.ProxyUrl); err != nil {
+			add("proxyUrl", SeverityError, "invalid proxy URL: %v", err)
+		} else if u.Host == "" {
+			add("proxyUrl", SeverityError, "invalid proxy URL %q: it must be in the form of SCHEME://HOST[:PORT]", c.ProxyUrl)
+		}
+	}
+
+	if c.AWSAuthConfig != nil && c.AWSAuthConfig.ClusterName == "" {
+		add("awsAuthConfig.clusterName", SeverityError, "clusterName is missing")
+	}
+
+	if c.ExecProviderConfig != nil && c.ExecProviderConfig.Command == "" {
+		add("execProviderConfig.command", SeverityError, "command is missing")
+	}
+
+	if c.ExecProviderConfig != nil {
+		switch v := c.ExecProviderConfig.APIVersion; v {
+		case ExecAPIVersionV1Alpha1, ExecAPIVersionV1Beta1, ExecAPIVersionV1:
+		case "":
+			add("execProviderConfig.apiVersion", SeverityError, "apiVersion is missing")
+		default:
+			add("execProviderConfig.apiVersion", SeverityError, "unsupported apiVersion %q. It must be one of %s, %s, or %s", v, ExecAPIVersionV1Alpha1, ExecAPIVersionV1Beta1, ExecAPIVersionV1)
+		}
+	}
+
+	return findings
+}
+
+// parseCertificates parses the PEM-encoded certificates.
+// It fails when data contains no certificate or any of the PEM blocks is not a valid certificate.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for rest := data; ; {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,234 @@
+package argocd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testCertificate returns a PEM-encoded self-signed certificate valid between notBefore and notAfter, and its key.
+func testCertificate(t *testing.T, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// jsonBytes returns s as the JSON value of a []byte field, which is a base64-encoded string.
+func jsonBytes(s string) string {
+	return `"` + base64.StdEncoding.EncodeToString([]byte(s)) + `"`
+}
+
+func TestLintSecret(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cert, key := testCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expiredCert, expiredKey := testCertificate(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	futureCert, futureKey := testCertificate(t, now.Add(time.Hour), now.Add(2*time.Hour))
+	_, otherKey := testCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	testcases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		data        map[string]string
+		// want is the findings in the form of FIELD:SEVERITY, in order
+		want []string
+	}{
+		{
+			name: "valid",
+			data: map[string]string{"server": "https://example.com", "name": "prod", "config": `{"bearerToken":"token","tlsClientConfig":{"insecure":false}}`},
+		},
+		{
+			name: "valid client certificate",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"certData":` + jsonBytes(cert) + `,"keyData":` + jsonBytes(key) + `,"caData":` + jsonBytes(cert) + `}}`},
+		},
+		{
+			name:   "missing label",
+			labels: map[string]string{},
+			data:   map[string]string{"server": "https://example.com", "config": `{}`},
+			want:   []string{"metadata.labels:warning"},
+		},
+		{
+			name:        "invalid refresh annotation",
+			annotations: map[string]string{"argocd.argoproj.io/refresh": "now"},
+			data:        map[string]string{"server": "https://example.com", "config": `{}`},
+			want:        []string{"metadata.annotations:warning"},
+		},
+		{
+			name: "unknown keys",
+			data: map[string]string{"server": "https://example.com", "config": `{}`, "token": "t", "Name": "prod"},
+			want: []string{"Name:warning", "token:warning"},
+		},
+		{
+			name: "missing server and config",
+			data: map[string]string{},
+			want: []string{"server:error", "config:warning"},
+		},
+		{
+			name: "server without scheme",
+			data: map[string]string{"server": "example.com:6443", "config": `{}`},
+			want: []string{"server:error"},
+		},
+		{
+			name: "unparsable server",
+			data: map[string]string{"server": "https://exa mple.com", "config": `{}`},
+			want: []string{"server:error"},
+		},
+		{
+			name: "http server",
+			data: map[string]string{"server": "http://example.com", "config": `{}`},
+			want: []string{"server:warning"},
+		},
+		{
+			name: "invalid shard and clusterResources",
+			data: map[string]string{"server": "https://example.com", "config": `{}`, "shard": "one", "clusterResources": "yes"},
+			want: []string{"shard:error", "clusterResources:warning"},
+		},
+		{
+			name: "negative shard",
+			data: map[string]string{"server": "https://example.com", "config": `{}`, "shard": "-1"},
+			want: []string{"shard:error"},
+		},
+		{
+			name: "malformed config",
+			data: map[string]string{"server": "https://example.com", "config": `{"bearerToken":`},
+			want: []string{"config:error"},
+		},
+		{
+			name: "unknown config field",
+			data: map[string]string{"server": "https://example.com", "config": `{"token":"t"}`},
+			want: []string{"config:warning"},
+		},
+		{
+			name: "invalid PEM data",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"insecure":true,"caData":"Y2E=","certData":"Y2VydA==","keyData":"a2V5"}}`},
+			want: []string{"config.tlsClientConfig.caData:error", "config.tlsClientConfig.insecure:warning", "config.tlsClientConfig.certData:error", "config.tlsClientConfig.keyData:error", "config.tlsClientConfig:error"},
+		},
+		{
+			name: "expired client certificate",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"certData":` + jsonBytes(expiredCert) + `,"keyData":` + jsonBytes(expiredKey) + `}}`},
+			want: []string{"config.tlsClientConfig.certData:error"},
+		},
+		{
+			name: "client certificate not valid yet",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"certData":` + jsonBytes(futureCert) + `,"keyData":` + jsonBytes(futureKey) + `}}`},
+			want: []string{"config.tlsClientConfig.certData:error"},
+		},
+		{
+			name: "mismatched client certificate and key",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"certData":` + jsonBytes(cert) + `,"keyData":` + jsonBytes(otherKey) + `}}`},
+			want: []string{"config.tlsClientConfig:error"},
+		},
+		{
+			name: "client certificate without key",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"certData":` + jsonBytes(cert) + `}}`},
+			want: []string{"config.tlsClientConfig.keyData:error"},
+		},
+		{
+			name: "key without client certificate",
+			data: map[string]string{"server": "https://example.com", "config": `{"tlsClientConfig":{"keyData":` + jsonBytes(key) + `}}`},
+			want: []string{"config.tlsClientConfig.certData:error"},
+		},
+		{
+			name: "credentials ignored by awsAuthConfig and execProviderConfig",
+			data: map[string]string{"server": "https://example.com", "config": `{"bearerToken":"t","username":"u","password":"p","awsAuthConfig":{"clusterName":"prod"},"execProviderConfig":{"command":"aws","apiVersion":"client.authentication.k8s.io/v1beta1"}}`},
+			want: []string{"config.execProviderConfig:error", "config.bearerToken:error", "config.username:error", "config.bearerToken:warning"},
+		},
+		{
+			name: "in-cluster ignores awsAuthConfig and execProviderConfig anyway",
+			data: map[string]string{"server": KubernetesInternalAPIServerAddr, "config": `{"bearerToken":"t","awsAuthConfig":{"clusterName":"prod"}}`},
+		},
+		{
+			name: "proxy URL without scheme",
+			data: map[string]string{"server": "https://example.com", "config": `{"proxyUrl":"proxy:3128"}`},
+			want: []string{"config.proxyUrl:error"},
+		},
+		{
+			name: "unparsable proxy URL",
+			data: map[string]string{"server": "https://example.com", "config": `{"proxyUrl":"http://pro xy"}`},
+			want: []string{"config.proxyUrl:error"},
+		},
+		{
+			name: "incomplete awsAuthConfig",
+			data: map[string]string{"server": "https://example.com", "name": "prod", "config": `{"awsAuthConfig":{}}`},
+			want: []string{"config.awsAuthConfig.clusterName:error"},
+		},
+		{
+			name: "incomplete execProviderConfig",
+			data: map[string]string{"server": "https://example.com", "config": `{"execProviderConfig":{}}`},
+			want: []string{"config.execProviderConfig.command:error", "config.execProviderConfig.apiVersion:error"},
+		},
+		{
+			name: "unsupported execProviderConfig apiVersion",
+			data: map[string]string{"server": "https://example.com", "config": `{"execProviderConfig":{"command":"kubelogin","apiVersion":"client.authentication.k8s.io/v2"}}`},
+			want: []string{"config.execProviderConfig.apiVersion:error"},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			labels := tc.labels
+			if labels == nil {
+				labels = map[string]string{LabelKeySecretType: LabelValueSecretTypeCluster}
+			}
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "cluster", Labels: labels, Annotations: tc.annotations},
+				Data:       map[string][]byte{},
+			}
+
+			for k, v := range tc.data {
+				secret.Data[k] = []byte(v)
+			}
+
+			var got []string
+			for _, f := range LintSecret(secret, now) {
+				got = append(got, f.Field+":"+f.Severity)
+
+				if f.Secret != "argocd/cluster" || f.Message == "" {
+					t.Errorf("unexpected finding: %+v", f)
+				}
+			}
+
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("unexpected findings:\nwant %v\ngot  %v", tc.want, got)
+			}
+		})
+	}
+}
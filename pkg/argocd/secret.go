@@ -0,0 +1,169 @@
+package argocd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ClusterToSecret converts the cluster into an ArgoCD cluster secret.
+// It is the inverse of SecretToCluster.
+func ClusterToSecret(c *Cluster, namespace, name string) (*corev1.Secret, error) {
+	config, err := json.Marshal(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{
+		"server": []byte(c.Server),
+		"name":   []byte(c.Name),
+		"config": config,
+	}
+
+	if len(c.Namespaces) > 0 {
+		data["namespaces"] = []byte(strings.Join(c.Namespaces, ","))
+	}
+
+	if c.ClusterResources {
+		data["clusterResources"] = []byte("true")
+	}
+
+	if c.Project != "" {
+		data["project"] = []byte(c.Project)
+	}
+
+	if c.Shard != nil {
+		data["shard"] = []byte(strconv.FormatInt(*c.Shard, 10))
+	}
+
+	labels := map[string]string{}
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+	labels[LabelKeySecretType] = LabelValueSecretTypeCluster
+
+	var annotations map[string]string
+	if len(c.Annotations) > 0 {
+		annotations = map[string]string{}
+		for k, v := range c.Annotations {
+			annotations[k] = v
+		}
+	}
+
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, nil
+}
+
+// NewClusterConfig converts the rest config into a ClusterConfig.
+// It is the inverse of RawRestConfig, and inlines the certificate, key and token files
+// because the ArgoCD application controller has no access to them.
+//
+// An exec provider that runs `aws eks get-token` is converted into an AWSAuthConfig,
+// so that the cluster secret looks the same as one registered with `argocd cluster add --aws-cluster-name`.
+func NewClusterConfig(restConfig *rest.Config) (ClusterConfig, error) {
+	config := rest.CopyConfig(restConfig)
+
+	if err := rest.LoadTLSFiles(config); err != nil {
+		return ClusterConfig{}, err
+	}
+
+	if config.AuthProvider != nil {
+		return ClusterConfig{}, fmt.Errorf("auth provider %q is not supported by ArgoCD cluster secrets. Use an exec credential plugin instead", config.AuthProvider.Name)
+	}
+
+	bearerToken := config.BearerToken
+	if bearerToken == "" && config.BearerTokenFile != "" {
+		token, err := ioutil.ReadFile(config.BearerTokenFile)
+		if err != nil {
+			return ClusterConfig{}, err
+		}
+
+		bearerToken = strings.TrimSpace(string(token))
+	}
+
+	c := ClusterConfig{
+		Username:    config.Username,
+		Password:    config.Password,
+		BearerToken: bearerToken,
+		TLSClientConfig: TLSClientConfig{
+			Insecure:   config.Insecure,
+			ServerName: config.ServerName,
+			CertData:   config.CertData,
+			KeyData:    config.KeyData,
+			CAData:     config.CAData,
+		},
+		DisableCompression: config.DisableCompression,
+		ProxyUrl:           proxyURL(config),
+	}
+
+	if exec := config.ExecProvider; exec != nil {
+		if aws := awsAuthConfigFromExec(exec.Command, exec.Args, exec.Env); aws != nil {
+			c.AWSAuthConfig = aws
+		} else {
+			var env map[string]string
+			if len(exec.Env) > 0 {
+				env = map[string]string{}
+				for _, e := range exec.Env {
+					env[e.Name] = e.Value
+				}
+			}
+
+			c.ExecProviderConfig = &ExecProviderConfig{
+				Command:     exec.Command,
+				Args:        exec.Args,
+				Env:         env,
+				APIVersion:  exec.APIVersion,
+				InstallHint: exec.InstallHint,
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// awsAuthConfigFromExec returns the AWSAuthConfig that RawRestConfig turns into the command, the args and the env,
+// or nil if RawRestConfig never produces them.
+func awsAuthConfigFromExec(command string, args []string, env []clientcmdapi.ExecEnvVar) *AWSAuthConfig {
+	if command != "aws" || len(args) < 4 || args[0] != "eks" || args[1] != "get-token" || args[2] != "--cluster-name" {
+		return nil
+	}
+
+	c := &AWSAuthConfig{ClusterName: args[3]}
+
+	switch rest := args[4:]; {
+	case len(rest) == 0:
+	case len(rest) == 2 && rest[0] == "--role-arn":
+		c.RoleARN = rest[1]
+	default:
+		return nil
+	}
+
+	for _, e := range env {
+		if e.Name != "AWS_PROFILE" {
+			return nil
+		}
+
+		c.Profile = e.Value
+	}
+
+	return c
+}
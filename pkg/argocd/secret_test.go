@@ -0,0 +1,157 @@
+package argocd
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/utils/pointer"
+)
+
+func TestClusterToSecretRoundTrip(t *testing.T) {
+	now := time.Now()
+	cert, key := testCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+	ca, _ := testCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	testcases := []struct {
+		name       string
+		restConfig *rest.Config
+		// wantAuth is the authentication method found in the cluster config
+		wantAuth string
+	}{
+		{
+			name: "bearer token",
+			restConfig: &rest.Config{
+				Host:               "https://10.0.0.1:6443",
+				BearerToken:        "token",
+				TLSClientConfig:    rest.TLSClientConfig{CAData: []byte(ca), ServerName: "kubernetes"},
+				DisableCompression: true,
+				Proxy:              http.ProxyURL(mustParseURL(t, "http://proxy.example.com:3128")),
+			},
+			wantAuth: "bearerToken",
+		},
+		{
+			name: "TLS client certificate",
+			restConfig: &rest.Config{
+				Host:            "https://10.0.0.2:6443",
+				TLSClientConfig: rest.TLSClientConfig{CertData: []byte(cert), KeyData: []byte(key), CAData: []byte(ca)},
+			},
+			wantAuth: "tls",
+		},
+		{
+			name: "awsAuthConfig",
+			restConfig: &rest.Config{
+				Host:            "https://SOME_ID.gr7.us-west-2.eks.amazonaws.com",
+				TLSClientConfig: rest.TLSClientConfig{CAData: []byte(ca)},
+				ExecProvider: &clientcmdapi.ExecConfig{
+					APIVersion: ExecAPIVersionV1Beta1,
+					Command:    "aws",
+					Args:       []string{"eks", "get-token", "--cluster-name", "prod", "--role-arn", "arn:aws:iam::123456789012:role/argocd"},
+					Env:        []clientcmdapi.ExecEnvVar{{Name: "AWS_PROFILE", Value: "prod"}},
+				},
+			},
+			wantAuth: "awsAuthConfig",
+		},
+		{
+			name: "execProviderConfig",
+			restConfig: &rest.Config{
+				Host:            "https://aks.example.com",
+				TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+				ExecProvider: &clientcmdapi.ExecConfig{
+					APIVersion:  ExecAPIVersionV1Beta1,
+					Command:     "kubelogin",
+					Args:        []string{"get-token", "--server-id", "6dae42f8-4368-4678-94ff-3960e28e3630"},
+					Env:         []clientcmdapi.ExecEnvVar{{Name: "AAD_LOGIN_METHOD", Value: "msi"}},
+					InstallHint: "install kubelogin",
+				},
+			},
+			wantAuth: "execProviderConfig",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := NewClusterConfig(tc.restConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := authMethod(config); got != tc.wantAuth {
+				t.Errorf("unexpected authentication method: want %s, got %s", tc.wantAuth, got)
+			}
+
+			want := &Cluster{
+				Server:           tc.restConfig.Host,
+				Name:             "cluster1",
+				Config:           config,
+				Namespaces:       []string{"default", "kube-system"},
+				ClusterResources: true,
+				Project:          "team-a",
+				Shard:            pointer.Int64Ptr(1),
+				Labels:           map[string]string{"env": "prod"},
+				Annotations:      map[string]string{"owner": "team-a"},
+			}
+
+			s, err := ClusterToSecret(want, "argocd", "cluster1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Labels[LabelKeySecretType] != LabelValueSecretTypeCluster {
+				t.Errorf("missing the label %s: %v", LabelKeySecretType, s.Labels)
+			}
+
+			got, err := SecretToCluster(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("the cluster changed in the round trip:\nwant %+v\ngot  %+v", want, got)
+			}
+
+			restConfig := got.RawRestConfig()
+
+			if restConfig.Host != tc.restConfig.Host || restConfig.BearerToken != tc.restConfig.BearerToken ||
+				!reflect.DeepEqual(restConfig.TLSClientConfig, tc.restConfig.TLSClientConfig) ||
+				!reflect.DeepEqual(restConfig.ExecProvider, tc.restConfig.ExecProvider) ||
+				restConfig.DisableCompression != tc.restConfig.DisableCompression ||
+				proxyURL(restConfig) != proxyURL(tc.restConfig) {
+				t.Errorf("the rest config changed in the round trip:\nwant %+v\ngot  %+v", tc.restConfig, restConfig)
+			}
+		})
+	}
+}
+
+// authMethod returns the name of the field of the cluster config that is used for authentication.
+func authMethod(c ClusterConfig) string {
+	switch {
+	case c.AWSAuthConfig != nil:
+		return "awsAuthConfig"
+	case c.ExecProviderConfig != nil:
+		return "execProviderConfig"
+	case c.BearerToken != "":
+		return "bearerToken"
+	case len(c.TLSClientConfig.CertData) > 0:
+		return "tls"
+	}
+
+	return ""
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
@@ -0,0 +1,42 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/rest"
+)
+
+// ClusterSource is a store of the clusters and their credentials, like the ArgoCD cluster secrets.
+//
+// Every source yields the same Cluster as the one converted from an ArgoCD cluster secret,
+// so that the cluster can be connected to in the same way regardless of where the credentials are stored.
+type ClusterSource interface {
+	// ListClusters returns all the clusters in the source.
+	ListClusters(ctx context.Context) ([]SourceCluster, error)
+	// GetCluster returns the cluster identified by the name.
+	// It returns a ClusterNotFoundError when the source has no such cluster.
+	GetCluster(ctx context.Context, name string) (*SourceCluster, error)
+}
+
+// SourceCluster is a cluster in a ClusterSource.
+type SourceCluster struct {
+	// Namespace is the namespace of the cluster secret. Empty for sources other than the cluster secrets
+	Namespace string
+	// Name identifies the cluster in the source, like the name of the cluster secret, the kubeconfig context, the file, or the Vault secret
+	Name    string
+	Cluster *Cluster
+	// RestConfig is the config to connect to the cluster with, when the source has one of its own like the kubeconfig does.
+	// When nil, the config is derived from Cluster.Config in the same way as ArgoCD does
+	RestConfig *rest.Config
+}
+
+// ClusterNotFoundError is returned by ClusterSource.GetCluster when the source has no such cluster.
+type ClusterNotFoundError struct {
+	Source string
+	Name   string
+}
+
+func (e *ClusterNotFoundError) Error() string {
+	return fmt.Sprintf("cluster %q not found in %s", e.Name, e.Source)
+}
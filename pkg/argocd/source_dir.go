@@ -0,0 +1,80 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirClusterSource reads the clusters from the JSON files in a local directory.
+//
+// Each file named NAME.json contains a Cluster in the same JSON format as the one returned by the ArgoCD API server,
+// like {"name":"prod","server":"https://...","config":{"bearerToken":"..."},"labels":{"env":"prod"}}.
+// Files encrypted at rest, like those managed with sops, must be decrypted into the directory beforehand.
+type DirClusterSource struct {
+	Dir string
+}
+
+const clusterFileExt = ".json"
+
+// ListClusters returns the clusters in all the JSON files in the directory, sorted by the file name.
+func (s *DirClusterSource) ListClusters(ctx context.Context) ([]SourceCluster, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []SourceCluster
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != clusterFileExt {
+			continue
+		}
+
+		c, err := s.GetCluster(ctx, strings.TrimSuffix(f.Name(), clusterFileExt))
+		if err != nil {
+			return nil, err
+		}
+
+		clusters = append(clusters, *c)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+
+	return clusters, nil
+}
+
+// GetCluster returns the cluster in the file NAME.json.
+func (s *DirClusterSource) GetCluster(ctx context.Context, name string) (*SourceCluster, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid cluster name %q. It must be the name of a file in %s without the %s extension", name, s.Dir, clusterFileExt)
+	}
+
+	path := filepath.Join(s.Dir, name+clusterFileExt)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, &ClusterNotFoundError{Source: "directory " + s.Dir, Name: name}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cluster Cluster
+
+	if err := json.Unmarshal(data, &cluster); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	if cluster.Server == "" {
+		return nil, fmt.Errorf("%s: missing server", path)
+	}
+
+	cluster.Server = strings.TrimRight(cluster.Server, "/")
+
+	return &SourceCluster{Name: name, Cluster: &cluster}, nil
+}
@@ -0,0 +1,96 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigClusterSource reads the clusters from the contexts in a kubeconfig file.
+// Each context is converted into a Cluster named after the context, in the same way as `wy print cluster-secret` does.
+// The clusters are connected to with the rest config of the context as is,
+// so that the contexts that can't be converted into an ArgoCD cluster secret, like the ones using auth providers, still work.
+type KubeconfigClusterSource struct {
+	// Path is the path to the kubeconfig file. Defaults to KUBECONFIG or ~/.kube/config
+	Path string
+}
+
+// ListClusters returns the clusters converted from all the contexts in the kubeconfig, sorted by the context name.
+// The contexts that are unusable, like the ones referring to missing certificate files, are skipped with a warning.
+func (s *KubeconfigClusterSource) ListClusters(ctx context.Context) ([]SourceCluster, error) {
+	config, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var clusters []SourceCluster
+
+	for _, name := range names {
+		c, err := s.cluster(config, name)
+		if err != nil {
+			log.Printf("Skipping context %s of the kubeconfig: %v", name, err)
+			continue
+		}
+
+		clusters = append(clusters, *c)
+	}
+
+	return clusters, nil
+}
+
+// GetCluster returns the cluster converted from the context.
+func (s *KubeconfigClusterSource) GetCluster(ctx context.Context, name string) (*SourceCluster, error) {
+	config, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := config.Contexts[name]; !ok {
+		return nil, &ClusterNotFoundError{Source: "the contexts of the kubeconfig", Name: name}
+	}
+
+	return s.cluster(config, name)
+}
+
+func (s *KubeconfigClusterSource) load() (*clientcmdapi.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = s.Path
+
+	return loadingRules.Load()
+}
+
+func (s *KubeconfigClusterSource) cluster(config *clientcmdapi.Config, name string) (*SourceCluster, error) {
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*config, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", name, err)
+	}
+
+	// The cluster config is informational, as we connect with the rest config.
+	// It's empty when the context uses what ArgoCD doesn't support, like an auth provider.
+	clusterConfig, err := NewClusterConfig(restConfig)
+	if err != nil {
+		clusterConfig = ClusterConfig{}
+	}
+
+	return &SourceCluster{
+		Name: name,
+		Cluster: &Cluster{
+			Server: strings.TrimRight(restConfig.Host, "/"),
+			Name:   name,
+			Config: clusterConfig,
+		},
+		RestConfig: restConfig,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package argocd
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+    insecure-skip-tls-verify: true
+users:
+- name: token
+  user:
+    token: dev-token
+- name: missing-cert
+  user:
+    client-certificate: /nonexistent/client.crt
+    client-key: /nonexistent/client.key
+- name: oidc
+  user:
+    auth-provider:
+      name: oidc
+      config:
+        client-id: wy
+        id-token: dummy
+        idp-issuer-url: https://issuer.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: token
+- name: dev-missing-cert
+  context:
+    cluster: dev
+    user: missing-cert
+- name: dev-oidc
+  context:
+    cluster: dev
+    user: oidc
+current-context: dev
+`
+
+func TestKubeconfigClusterSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &KubeconfigClusterSource{Path: path}
+	ctx := context.Background()
+
+	clusters, err := s.ListClusters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, c := range clusters {
+		names = append(names, c.Name)
+
+		if c.RestConfig == nil {
+			t.Errorf("missing rest config of context %s", c.Name)
+		}
+
+		if c.Cluster.Server != "https://dev.example.com" {
+			t.Errorf("unexpected server of context %s: %s", c.Name, c.Cluster.Server)
+		}
+	}
+
+	if len(names) != 2 || names[0] != "dev" || names[1] != "dev-oidc" {
+		t.Fatalf("unexpected contexts: want [dev dev-oidc], got %v", names)
+	}
+
+	if got := clusters[0].Cluster.Config.BearerToken; got != "dev-token" {
+		t.Errorf("unexpected bearer token: want dev-token, got %q", got)
+	}
+
+	if p := clusters[1].RestConfig.AuthProvider; p == nil || p.Name != "oidc" {
+		t.Errorf("the rest config of context dev-oidc lost the auth provider: %v", p)
+	}
+
+	if _, err := s.GetCluster(ctx, "dev-missing-cert"); err == nil {
+		t.Error("expected an error for the context referring to the missing certificate")
+	}
+}
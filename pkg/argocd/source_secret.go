@@ -0,0 +1,66 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretClusterSource reads the clusters from the ArgoCD cluster secrets, like the ArgoCD application controller does.
+type SecretClusterSource struct {
+	Clientset kubernetes.Interface
+	// Namespace is where the cluster secrets are listed, and the default namespace of the cluster secret given to GetCluster
+	Namespace string
+}
+
+// ListClusters returns the clusters converted from the cluster secrets in the namespace.
+func (s *SecretClusterSource) ListClusters(ctx context.Context) ([]SourceCluster, error) {
+	secrets, err := s.Clientset.CoreV1().Secrets(s.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: LabelKeySecretType + "=" + LabelValueSecretTypeCluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []SourceCluster
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		cluster, err := SecretToCluster(secret)
+		if err != nil {
+			return nil, fmt.Errorf("converting secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+
+		clusters = append(clusters, SourceCluster{Namespace: secret.Namespace, Name: secret.Name, Cluster: cluster})
+	}
+
+	return clusters, nil
+}
+
+// GetCluster returns the cluster converted from the cluster secret named NAME or NAMESPACE/NAME.
+// Unlike ListClusters, the secret doesn't need to be labeled as an ArgoCD cluster secret.
+func (s *SecretClusterSource) GetCluster(ctx context.Context, name string) (*SourceCluster, error) {
+	ns := s.Namespace
+	if nsName := strings.SplitN(name, "/", 2); len(nsName) == 2 {
+		ns, name = nsName[0], nsName[1]
+	}
+
+	secret, err := s.Clientset.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, &ClusterNotFoundError{Source: "the cluster secrets in namespace " + ns, Name: name}
+	} else if err != nil {
+		return nil, err
+	}
+
+	cluster, err := SecretToCluster(secret)
+	if err != nil {
+		return nil, fmt.Errorf("converting secret %s/%s: %w", ns, name, err)
+	}
+
+	return &SourceCluster{Namespace: ns, Name: name, Cluster: cluster}, nil
+}
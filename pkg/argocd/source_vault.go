@@ -0,0 +1,339 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// VaultClusterSource reads the clusters from the secrets under a path of a HashiCorp Vault KV secrets engine.
+//
+// Each secret at PATH/NAME has the same keys as the data of an ArgoCD cluster secret, like name, server, config,
+// namespaces, clusterResources and project, so that it can be created from an existing cluster secret as is.
+// The config can be either the JSON string or the JSON object. The optional labels key holds the labels of the cluster,
+// in the form of k1=v1,k2=v2 or a JSON object, that are matched against -argocd-cluster-selector.
+//
+// Both the KV version 1 and 2 secrets engines are supported. The version is detected in the same way as the vault CLI does.
+type VaultClusterSource struct {
+	address   string
+	token     string
+	namespace string
+	path      string
+	client    *http.Client
+}
+
+// VaultError is an error response from Vault.
+type VaultError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *VaultError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("Vault responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("Vault responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), strings.Join(e.Errors, ", "))
+}
+
+// NewVaultClusterSource returns a source of the clusters stored under the path, like secret/wy/clusters, of the Vault server.
+// The address and the token are those given to the vault CLI via VAULT_ADDR and VAULT_TOKEN.
+// The namespace is the Vault Enterprise namespace, which is empty for Vault OSS.
+func NewVaultClusterSource(address, token, namespace, path string) (*VaultClusterSource, error) {
+	if address == "" {
+		return nil, fmt.Errorf("missing Vault address. Set VAULT_ADDR")
+	}
+
+	if _, err := url.Parse(address); err != nil {
+		return nil, fmt.Errorf("invalid Vault address %q: %w", address, err)
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("missing Vault path, like secret/clusters")
+	}
+
+	return &VaultClusterSource{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		namespace: namespace,
+		path:      path,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// ListClusters returns the clusters in all the secrets right under the path, sorted by the secret name.
+func (s *VaultClusterSource) ListClusters(ctx context.Context) ([]SourceCluster, error) {
+	kv, err := s.kvPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+
+	// Vault responds with 404 when there's no secret under the path
+	if err := s.get(ctx, kv.list+"?list=true", &list); isVaultNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var clusters []SourceCluster
+
+	for _, key := range list.Data.Keys {
+		// Keys ending with a slash are sub-paths, not secrets
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		c, err := s.getCluster(ctx, kv, key)
+		if err != nil {
+			return nil, err
+		}
+
+		clusters = append(clusters, *c)
+	}
+
+	return clusters, nil
+}
+
+// GetCluster returns the cluster in the secret PATH/NAME.
+func (s *VaultClusterSource) GetCluster(ctx context.Context, name string) (*SourceCluster, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid cluster name %q. It must be the name of a secret right under %s", name, s.path)
+	}
+
+	kv, err := s.kvPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getCluster(ctx, kv, name)
+}
+
+// getCluster reads the secret NAME via the API paths of the KV secrets engine, so that ListClusters looks up the mount only once.
+func (s *VaultClusterSource) getCluster(ctx context.Context, kv *kvEndpoints, name string) (*SourceCluster, error) {
+	var res struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if err := s.get(ctx, kv.read+"/"+url.PathEscape(name), &res); isVaultNotFound(err) {
+		return nil, &ClusterNotFoundError{Source: "Vault path " + s.path, Name: name}
+	} else if err != nil {
+		return nil, err
+	}
+
+	data := res.Data
+
+	// The KV version 2 secrets engine wraps the secret with the metadata, like {"data":{"data":{...},"metadata":{...}}}
+	if kv.v2 {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, fmt.Errorf("decoding Vault secret %s/%s: %w", s.path, name, err)
+		}
+
+		data = v2.Data
+	}
+
+	var values map[string]interface{}
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("decoding Vault secret %s/%s: %w", s.path, name, err)
+	}
+
+	// A deleted KV version 2 secret has null data
+	if values == nil {
+		return nil, &ClusterNotFoundError{Source: "Vault path " + s.path, Name: name}
+	}
+
+	cluster, err := vaultSecretToCluster(name, values)
+	if err != nil {
+		return nil, fmt.Errorf("Vault secret %s/%s: %w", s.path, name, err)
+	}
+
+	return &SourceCluster{Name: name, Cluster: cluster}, nil
+}
+
+// vaultSecretToCluster converts the Vault secret into a Cluster via the ArgoCD cluster secret that has the same data.
+func vaultSecretToCluster(name string, values map[string]interface{}) (*Cluster, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{},
+		},
+		Data: map[string][]byte{},
+	}
+
+	for k, v := range values {
+		if k == "labels" {
+			l, err := vaultLabels(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid labels: %w", err)
+			}
+
+			secret.Labels = l
+
+			continue
+		}
+
+		if s, ok := v.(string); ok {
+			secret.Data[k] = []byte(s)
+			continue
+		}
+
+		// Non-string values like the config object and the clusterResources boolean are stored as JSON
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", k, err)
+		}
+
+		secret.Data[k] = data
+	}
+
+	if len(secret.Data["server"]) == 0 {
+		return nil, fmt.Errorf("missing server")
+	}
+
+	return SecretToCluster(secret)
+}
+
+func vaultLabels(v interface{}) (map[string]string, error) {
+	switch l := v.(type) {
+	case string:
+		return labels.ConvertSelectorToLabelsMap(l)
+	case map[string]interface{}:
+		m := map[string]string{}
+		for k, v := range l {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("the value of %s must be a string", k)
+			}
+
+			m[k] = s
+		}
+
+		return m, nil
+	default:
+		return nil, fmt.Errorf("it must be either k1=v1,k2=v2 or a JSON object")
+	}
+}
+
+// kvEndpoints is the API paths to list and read the secrets under the path of a KV secrets engine.
+type kvEndpoints struct {
+	list string
+	read string
+	v2   bool
+}
+
+// kvPaths returns the API paths to list and read the secrets under the path,
+// which depend on the version of the KV secrets engine mounted at the path.
+func (s *VaultClusterSource) kvPaths(ctx context.Context) (*kvEndpoints, error) {
+	var mount struct {
+		Data struct {
+			Path    string `json:"path"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+
+	v1 := &kvEndpoints{list: s.path, read: s.path}
+
+	// This is how the vault CLI detects the KV version. Like the CLI, we assume version 1 when the token is not allowed to read it
+	if err := s.get(ctx, "sys/internal/ui/mounts/"+s.path, &mount); err != nil {
+		if e, ok := err.(*VaultError); ok && e.StatusCode == http.StatusForbidden {
+			return v1, nil
+		}
+
+		return nil, err
+	}
+
+	if mount.Data.Options.Version != "2" {
+		return v1, nil
+	}
+
+	mountPath := strings.TrimSuffix(mount.Data.Path, "/")
+	rest := strings.TrimPrefix(strings.TrimPrefix(s.path, mountPath), "/")
+
+	return &kvEndpoints{
+		list: join(mountPath, "metadata", rest),
+		read: join(mountPath, "data", rest),
+		v2:   true,
+	}, nil
+}
+
+func join(elems ...string) string {
+	var nonEmpty []string
+
+	for _, e := range elems {
+		if e != "" {
+			nonEmpty = append(nonEmpty, e)
+		}
+	}
+
+	return strings.Join(nonEmpty, "/")
+}
+
+func (s *VaultClusterSource) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.address+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+
+		_ = json.Unmarshal(body, &e)
+
+		return &VaultError{StatusCode: res.StatusCode, Errors: e.Errors}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding the response from %s: %w", req.URL, err)
+	}
+
+	return nil
+}
+
+func isVaultNotFound(err error) bool {
+	e, ok := err.(*VaultError)
+
+	return ok && e.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,144 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVaultClusterSource(t *testing.T) {
+	secrets := map[string]map[string]interface{}{
+		"dev": {
+			"name":   "dev",
+			"server": "https://dev.example.com",
+			"config": map[string]interface{}{"bearerToken": "dev-token"},
+			"labels": "env=dev",
+		},
+		"prod": {
+			"name":   "prod",
+			"server": "https://prod.example.com",
+			"config": `{"bearerToken":"prod-token"}`,
+			"labels": map[string]interface{}{"env": "prod"},
+		},
+	}
+
+	testcases := []struct {
+		name    string
+		version string
+	}{
+		{name: "kv version 1", version: "1"},
+		{name: "kv version 2", version: "2"},
+		{name: "kv version unknown to the token", version: ""},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var mountLookups int
+
+			listPath, readPath := "/v1/secret/wy/clusters", "/v1/secret/wy/clusters/"
+			if tc.version == "2" {
+				listPath, readPath = "/v1/secret/metadata/wy/clusters", "/v1/secret/data/wy/clusters/"
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Vault-Token") != "root" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				var res interface{}
+
+				switch {
+				case r.URL.Path == "/v1/sys/internal/ui/mounts/secret/wy/clusters":
+					mountLookups++
+
+					if tc.version == "" {
+						w.WriteHeader(http.StatusForbidden)
+						_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+						return
+					}
+
+					res = map[string]interface{}{"data": map[string]interface{}{"path": "secret/", "options": map[string]string{"version": tc.version}}}
+				case r.URL.Path == listPath && r.URL.Query().Get("list") == "true":
+					res = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"dev", "prod", "sub/"}}}
+				case strings.HasPrefix(r.URL.Path, readPath):
+					data, ok := secrets[strings.TrimPrefix(r.URL.Path, readPath)]
+					if !ok {
+						w.WriteHeader(http.StatusNotFound)
+						_, _ = w.Write([]byte(`{"errors":[]}`))
+						return
+					}
+
+					if tc.version == "2" {
+						res = map[string]interface{}{"data": map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 1}}}
+					} else {
+						res = map[string]interface{}{"data": data}
+					}
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"errors":[]}`))
+					return
+				}
+
+				_ = json.NewEncoder(w).Encode(res)
+			}))
+			defer srv.Close()
+
+			s, err := NewVaultClusterSource(srv.URL, "root", "", "/secret/wy/clusters/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+
+			clusters, err := s.ListClusters(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mountLookups != 1 {
+				t.Errorf("unexpected number of mount lookups: want 1, got %d", mountLookups)
+			}
+
+			if len(clusters) != 2 {
+				t.Fatalf("unexpected number of clusters: want 2, got %d", len(clusters))
+			}
+
+			for _, c := range clusters {
+				want := secrets[c.Name]
+
+				if c.Namespace != "" || c.Cluster.Name != want["name"] || c.Cluster.Server != want["server"] {
+					t.Errorf("unexpected cluster %s: namespace %q, name %q, server %q", c.Name, c.Namespace, c.Cluster.Name, c.Cluster.Server)
+				}
+
+				if got, want := c.Cluster.Config.BearerToken, c.Name+"-token"; got != want {
+					t.Errorf("unexpected bearer token of cluster %s: want %q, got %q", c.Name, want, got)
+				}
+
+				if got, want := c.Cluster.Labels["env"], c.Name; got != want {
+					t.Errorf("unexpected env label of cluster %s: want %q, got %q", c.Name, want, got)
+				}
+			}
+
+			c, err := s.GetCluster(ctx, "prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Cluster.Server != "https://prod.example.com" {
+				t.Errorf("unexpected server: %s", c.Cluster.Server)
+			}
+
+			var notFound *ClusterNotFoundError
+			if _, err := s.GetCluster(ctx, "staging"); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error for a missing cluster: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,707 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+var (
+	portForwardReconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "port_forward_reconnects_total",
+		Help: "Count of port-forward reconnections to a new pod",
+	}, []string{"target", "reason"})
+)
+
+// portForwardTarget specifies the pods a port-forward can be established to.
+type portForwardTarget struct {
+	Namespace string
+	// Service selects the pods by the selector of the service
+	Service string
+	// Selector selects the pods by the label selector
+	Selector string
+	// Pod is the name of the only pod to forward to
+	Pod string
+}
+
+// newPortForwardTarget builds a target from the values of the -namespace, -service, -pod and -selector flags.
+// -service and -pod accept the NAMESPACE/NAME syntax as an alternative to -namespace.
+func newPortForwardTarget(namespace, service, pod, selector string) (portForwardTarget, error) {
+	var specified []string
+	for f, v := range map[string]string{"-service": service, "-pod": pod, "-selector": selector} {
+		if v != "" {
+			specified = append(specified, f)
+		}
+	}
+
+	if len(specified) > 1 {
+		sort.Strings(specified)
+		return portForwardTarget{}, fmt.Errorf("only one of -service, -pod and -selector can be specified, but got %s", strings.Join(specified, ", "))
+	}
+
+	t := portForwardTarget{Namespace: namespace, Selector: selector}
+
+	for _, n := range []struct {
+		value string
+		name  *string
+	}{
+		{service, &t.Service},
+		{pod, &t.Pod},
+	} {
+		if n.value == "" {
+			continue
+		}
+
+		ns, name := splitNamespacedName(n.value, namespace)
+		if namespace != "" && ns != namespace {
+			return portForwardTarget{}, fmt.Errorf("namespace %q in %q conflicts with -namespace %q", ns, n.value, namespace)
+		}
+
+		t.Namespace = ns
+		*n.name = name
+	}
+
+	if t.Namespace == "" {
+		t.Namespace = "default"
+	}
+
+	return t, nil
+}
+
+// IsZero returns true when no pods are targeted.
+func (t portForwardTarget) IsZero() bool {
+	return t.Service == "" && t.Pod == "" && t.Selector == ""
+}
+
+func (t portForwardTarget) String() string {
+	switch {
+	case t.Pod != "":
+		return t.Namespace + "/pod/" + t.Pod
+	case t.Service != "":
+		return t.Namespace + "/service/" + t.Service
+	default:
+		return t.Namespace + "/pods/" + t.Selector
+	}
+}
+
+// reconnectTimeout is how long a repeat with a finite -count waits for a lost port-forward to be re-established before failing.
+// With -forever, it waits until a pod becomes ready.
+const reconnectTimeout = time.Minute
+
+const (
+	reconnectReasonLost          = "lost"
+	reconnectReasonUnhealthy     = "unhealthy"
+	reconnectReasonRequestFailed = "request_failed"
+)
+
+// portForwarder forwards a local port to one of the ready pods selected by a portForwardTarget.
+//
+// Unlike a one-shot port-forward, it keeps watching the tunnel and the pod,
+// and re-establishes the forward to another ready pod when the current one
+// is deleted, rolled, or otherwise becomes unreachable.
+type portForwarder struct {
+	restConfig *rest.Config
+	clientset  kubernetes.Interface
+
+	target     portForwardTarget
+	localPort  int
+	remotePort int
+
+	healthCheckInterval time.Duration
+	retryInterval       time.Duration
+
+	reconnectCh chan string
+	cancel      context.CancelFunc
+
+	mu         sync.Mutex
+	pod        string
+	ready      bool
+	generation int
+	// connectErr is the last error of re-establishing the forward, reported by Reconnect when it gives up
+	connectErr error
+	stopCh     chan struct{}
+	lostCh     chan struct{}
+}
+
+func newPortForwarder(restConfig *rest.Config, target portForwardTarget, localPort, remotePort int, healthCheckInterval time.Duration) (*portForwarder, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Namespace == "" {
+		target.Namespace = "default"
+	}
+
+	return &portForwarder{
+		restConfig:          restConfig,
+		clientset:           clientset,
+		target:              target,
+		localPort:           localPort,
+		remotePort:          remotePort,
+		healthCheckInterval: healthCheckInterval,
+		retryInterval:       time.Second,
+		reconnectCh:         make(chan string, 1),
+	}, nil
+}
+
+// Start establishes the first forward and keeps it alive until ctx is done.
+// It returns an error only when the first forward could not be established.
+func (f *portForwarder) Start(ctx context.Context) error {
+	ctx, f.cancel = context.WithCancel(ctx)
+
+	if err := f.connect(ctx); err != nil {
+		return err
+	}
+
+	go f.supervise(ctx)
+
+	return nil
+}
+
+// Reconnect asks the forwarder to re-establish the forward to a ready pod and
+// blocks until the new forward is ready or ctx is done.
+// Pass a ctx with a deadline to give up when no pod becomes ready, like when the -pod target was deleted.
+func (f *portForwarder) Reconnect(ctx context.Context, reason string) error {
+	generation := f.currentGeneration()
+
+	f.RequestReconnect(reason)
+
+	for f.currentGeneration() == generation {
+		select {
+		case <-ctx.Done():
+			f.mu.Lock()
+			err := f.connectErr
+			f.mu.Unlock()
+
+			if err == nil {
+				return fmt.Errorf("re-establishing port-forward for %s: %w", f.target, ctx.Err())
+			}
+
+			return fmt.Errorf("re-establishing port-forward for %s: %v: %w", f.target, ctx.Err(), err)
+		case <-time.After(f.retryInterval):
+		}
+	}
+
+	return nil
+}
+
+// RequestReconnect asks the forwarder to re-establish the forward without waiting for it.
+func (f *portForwarder) RequestReconnect(reason string) {
+	f.mu.Lock()
+	f.ready = false
+	f.mu.Unlock()
+
+	select {
+	case f.reconnectCh <- reason:
+	default:
+		// A reconnection is already pending
+	}
+}
+
+// Ready returns true when the forward is established and no reconnection is pending.
+func (f *portForwarder) Ready() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.ready
+}
+
+// Close stops the current forward and the reconnection.
+func (f *portForwarder) Close() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stop()
+}
+
+func (f *portForwarder) stop() {
+	if f.stopCh != nil {
+		close(f.stopCh)
+		f.stopCh = nil
+
+		// Wait for the local listener to be closed so that the next forward can reuse the local port
+		<-f.lostCh
+	}
+}
+
+func (f *portForwarder) supervise(ctx context.Context) {
+	var healthCheck <-chan time.Time
+	if f.healthCheckInterval > 0 {
+		ticker := time.NewTicker(f.healthCheckInterval)
+		defer ticker.Stop()
+		healthCheck = ticker.C
+	}
+
+	for {
+		f.mu.Lock()
+		lost := f.lostCh
+		f.mu.Unlock()
+
+		var reason string
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return
+		case <-lost:
+			reason = reconnectReasonLost
+		case reason = <-f.reconnectCh:
+		case <-healthCheck:
+			err := f.healthy(ctx)
+			if err == nil {
+				continue
+			}
+			log.Printf("Port-forward to pod %s failed health check: %v", f.currentPod(), err)
+			reason = reconnectReasonUnhealthy
+		}
+
+		f.mu.Lock()
+		f.ready = false
+		f.mu.Unlock()
+
+		log.Printf("Reconnecting port-forward for %s (reason: %s)", f.target, reason)
+		portForwardReconnectsTotal.WithLabelValues(f.target.String(), reason).Inc()
+
+		for {
+			err := f.connect(ctx)
+
+			f.mu.Lock()
+			f.connectErr = err
+			f.mu.Unlock()
+
+			if err == nil {
+				break
+			}
+
+			log.Printf("Unable to re-establish port-forward for %s: %v", f.target, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(f.retryInterval):
+			}
+		}
+	}
+}
+
+// LocalPort returns the local port of the forward.
+// When the forwarder was created with the local port 0, it returns the port allocated on the first connection.
+func (f *portForwarder) LocalPort() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.localPort
+}
+
+func (f *portForwarder) currentGeneration() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.generation
+}
+
+func (f *portForwarder) currentPod() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pod
+}
+
+// healthy checks that the pod we forward to is still ready and that the local end of the tunnel accepts connections.
+func (f *portForwarder) healthy(ctx context.Context) error {
+	pod, err := f.clientset.CoreV1().Pods(f.target.Namespace).Get(ctx, f.currentPod(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !isPodReady(pod) {
+		return fmt.Errorf("pod %s is not ready", pod.Name)
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", f.LocalPort()), 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// connect stops the current forward if any and starts a new one to a ready pod.
+func (f *portForwarder) connect(ctx context.Context) error {
+	pods, err := readyPods(ctx, f.clientset, f.target)
+	if err != nil {
+		return err
+	}
+
+	pod := pods[0]
+
+	f.mu.Lock()
+	f.stop()
+	f.mu.Unlock()
+
+	// Progress messages go to stderr so that they don't mix with the responses printed to stdout
+	fmt.Fprintf(os.Stderr, "Forwarding %v to pod %v ...\n", f.target, pod.Name)
+
+	transport, upgrader, err := spdy.RoundTripperFor(f.restConfig)
+	if err != nil {
+		return err
+	}
+
+	url := f.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("portforward").
+		URL()
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	lostCh := make(chan struct{})
+
+	pf, err := portforward.New(dialer, []string{fmt.Sprintf("%d:%d", f.LocalPort(), f.remotePort)}, stopCh, readyCh, os.Stderr, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(lostCh)
+
+		if err := pf.ForwardPorts(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-readyCh:
+	case <-lostCh:
+		close(stopCh)
+		select {
+		case err := <-errCh:
+			return err
+		default:
+			return fmt.Errorf("port-forward to pod %s stopped before it became ready", pod.Name)
+		}
+	case <-ctx.Done():
+		close(stopCh)
+		return ctx.Err()
+	}
+
+	ports, err := pf.GetPorts()
+	if err != nil {
+		close(stopCh)
+		return err
+	}
+
+	f.mu.Lock()
+	// Reuse the allocated port on reconnection so that the URL keeps working
+	f.localPort = int(ports[0].Local)
+	f.pod = pod.Name
+	f.stopCh = stopCh
+	f.lostCh = lostCh
+	f.ready = true
+	f.generation++
+	f.mu.Unlock()
+
+	return nil
+}
+
+// readyPods returns the ready pods selected by the target.
+func readyPods(ctx context.Context, clientset kubernetes.Interface, target portForwardTarget) ([]corev1.Pod, error) {
+	pods, err := selectPods(ctx, clientset, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var ready []corev1.Pod
+
+	for _, pod := range pods {
+		if isPodReady(&pod) {
+			ready = append(ready, pod)
+		}
+	}
+
+	if len(ready) == 0 {
+		if target.Pod != "" {
+			return nil, fmt.Errorf("pod %s is not ready", target.Pod)
+		}
+
+		return nil, fmt.Errorf("no ready pods found for %s", target)
+	}
+
+	return ready, nil
+}
+
+// selectPods returns all the pods selected by the target, regardless of their readiness.
+func selectPods(ctx context.Context, clientset kubernetes.Interface, target portForwardTarget) ([]corev1.Pod, error) {
+	if target.Pod != "" {
+		pod, err := clientset.CoreV1().Pods(target.Namespace).Get(ctx, target.Pod, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		return []corev1.Pod{*pod}, nil
+	}
+
+	selector := target.Selector
+
+	if target.Service != "" {
+		svc, err := clientset.CoreV1().Services(target.Namespace).Get(ctx, target.Service, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		var labels []string
+		for k, v := range svc.Spec.Selector {
+			labels = append(labels, k+"="+v)
+		}
+
+		if len(labels) == 0 {
+			return nil, fmt.Errorf("service %s has no selector", target.Service)
+		}
+
+		selector = strings.Join(labels, ",")
+	}
+
+	pods, err := clientset.CoreV1().Pods(target.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	return pods.Items, nil
+}
+
+// podResyncInterval is how often a portForwarderPool re-lists the pods selected by the target.
+const podResyncInterval = 10 * time.Second
+
+// portForwarderPool keeps a port-forward to each of the ready pods selected by a target.
+//
+// Each port-forward is pinned to a pod. The pool re-lists the pods periodically,
+// starts port-forwards to new ready pods and drops the ones to the pods that are gone,
+// so that it keeps up with the pods replaced in a rollout.
+type portForwarderPool struct {
+	restConfig          *rest.Config
+	clientset           kubernetes.Interface
+	target              portForwardTarget
+	localPort           int
+	remotePort          int
+	healthCheckInterval time.Duration
+
+	mu   sync.Mutex
+	fwds []*portForwarder
+}
+
+// forwardToReadyPods starts a port-forward for each of the ready pods selected by the target, and keeps them in sync with the pods until ctx is done.
+// The local ports are allocated consecutively starting from localPort, or randomly when localPort is 0.
+func forwardToReadyPods(ctx context.Context, restConfig *rest.Config, target portForwardTarget, localPort, remotePort int, healthCheckInterval time.Duration) (*portForwarderPool, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Namespace == "" {
+		target.Namespace = "default"
+	}
+
+	p := &portForwarderPool{
+		restConfig:          restConfig,
+		clientset:           clientset,
+		target:              target,
+		localPort:           localPort,
+		remotePort:          remotePort,
+		healthCheckInterval: healthCheckInterval,
+	}
+
+	pods, err := readyPods(ctx, clientset, target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods {
+		if _, err := p.add(ctx, pod); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
+	go p.resync(ctx, podResyncInterval)
+
+	return p, nil
+}
+
+// Forwarders returns the current port-forwards, in the order they were started.
+func (p *portForwarderPool) Forwarders() []*portForwarder {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*portForwarder(nil), p.fwds...)
+}
+
+// Close stops all the port-forwards.
+func (p *portForwarderPool) Close() {
+	closePortForwarders(p.Forwarders())
+}
+
+// add starts a port-forward to the pod on the lowest local port that is not in use by the pool.
+func (p *portForwarderPool) add(ctx context.Context, pod corev1.Pod) (*portForwarder, error) {
+	fwd, err := newPortForwarder(p.restConfig, portForwardTarget{Namespace: pod.Namespace, Pod: pod.Name}, p.freeLocalPort(), p.remotePort, p.healthCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fwd.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.fwds = append(p.fwds, fwd)
+	p.mu.Unlock()
+
+	return fwd, nil
+}
+
+func (p *portForwarderPool) freeLocalPort() int {
+	if p.localPort == 0 {
+		return 0
+	}
+
+	used := map[int]bool{}
+	for _, f := range p.Forwarders() {
+		used[f.LocalPort()] = true
+	}
+
+	port := p.localPort
+	for used[port] {
+		port++
+	}
+
+	return port
+}
+
+func (p *portForwarderPool) resync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := p.sync(ctx); err != nil {
+			log.Printf("Unable to re-list pods for %s: %v", p.target, err)
+		}
+	}
+}
+
+// sync drops the port-forwards to the pods that are gone or terminating, and starts ones to the new ready pods.
+// The port-forwards to the pods that still exist but are not ready are kept, as they reconnect by themselves once the pods become ready.
+func (p *portForwarderPool) sync(ctx context.Context) error {
+	pods, err := selectPods(ctx, p.clientset, p.target)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			existing[pod.Name] = true
+		}
+	}
+
+	var gone []*portForwarder
+
+	forwarded := map[string]bool{}
+
+	p.mu.Lock()
+	kept := p.fwds[:0:0]
+	for _, f := range p.fwds {
+		if existing[f.target.Pod] {
+			kept = append(kept, f)
+			forwarded[f.target.Pod] = true
+		} else {
+			gone = append(gone, f)
+		}
+	}
+	p.fwds = kept
+	p.mu.Unlock()
+
+	for _, f := range gone {
+		log.Printf("Dropping port-forward to pod %s that is gone", f.target.Pod)
+		f.Close()
+	}
+
+	for _, pod := range pods {
+		if forwarded[pod.Name] || !isPodReady(&pod) {
+			continue
+		}
+
+		fwd, err := p.add(ctx, pod)
+		if err != nil {
+			log.Printf("Unable to start port-forward to new pod %s: %v", pod.Name, err)
+			continue
+		}
+
+		log.Printf("Started port-forward to new pod %s on local port %d", pod.Name, fwd.LocalPort())
+	}
+
+	return nil
+}
+
+// nextReadyPortForwarder returns the next ready port-forward after the one at *next in a round-robin manner.
+// It returns nil when none of the port-forwards are ready.
+func nextReadyPortForwarder(fwds []*portForwarder, next *int) (int, *portForwarder) {
+	for k := 0; k < len(fwds); k++ {
+		i := (*next + k) % len(fwds)
+		if fwds[i].Ready() {
+			*next = i + 1
+			return i, fwds[i]
+		}
+	}
+
+	return -1, nil
+}
+
+func closePortForwarders(fwds []*portForwarder) {
+	for _, f := range fwds {
+		f.Close()
+	}
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPortForwarderReconnectTimesOutWithoutReadyPods(t *testing.T) {
+	f := &portForwarder{
+		clientset:     fake.NewSimpleClientset(),
+		target:        portForwardTarget{Namespace: "default", Pod: "deleted"},
+		retryInterval: 10 * time.Millisecond,
+		reconnectCh:   make(chan string, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go f.supervise(ctx)
+
+	reconnectCtx, cancelReconnect := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelReconnect()
+
+	err := f.Reconnect(reconnectCtx, reconnectReasonRequestFailed)
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), `pods "deleted" not found`) {
+		t.Errorf("expected the error to include the last connection error, got %v", err)
+	}
+}
+
+func TestPortForwarderPoolSyncDropsForwardsToPodsThatAreGone(t *testing.T) {
+	now := metav1.Now()
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "restarting", Labels: map[string]string{"app": "wy"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "terminating", Labels: map[string]string{"app": "wy"}, DeletionTimestamp: &now}},
+	)
+
+	forwarderTo := func(pod string) *portForwarder {
+		return &portForwarder{target: portForwardTarget{Namespace: "default", Pod: pod}}
+	}
+
+	p := &portForwarderPool{
+		clientset: clientset,
+		target:    portForwardTarget{Namespace: "default", Selector: "app=wy"},
+		fwds:      []*portForwarder{forwarderTo("deleted"), forwarderTo("restarting"), forwarderTo("terminating")},
+	}
+
+	if err := p.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var pods []string
+	for _, f := range p.Forwarders() {
+		pods = append(pods, f.target.Pod)
+	}
+
+	if got, want := strings.Join(pods, ","), "restarting"; got != want {
+		t.Errorf("unexpected pods: got %s, want %s", got, want)
+	}
+}
+
+func TestPortForwarderPoolFreeLocalPort(t *testing.T) {
+	p := &portForwarderPool{
+		localPort: 8080,
+		fwds:      []*portForwarder{{localPort: 8080}, {localPort: 8082}},
+	}
+
+	if got := p.freeLocalPort(); got != 8081 {
+		t.Errorf("unexpected port: got %d, want 8081", got)
+	}
+
+	if got := (&portForwarderPool{}).freeLocalPort(); got != 0 {
+		t.Errorf("unexpected port: got %d, want 0 for the random port", got)
+	}
+}
+
+func TestNewPortForwardTarget(t *testing.T) {
+	testcases := []struct {
+		name                         string
+		namespace, service, pod, sel string
+		want                         portForwardTarget
+		wantErr                      string
+	}{
+		{
+			name:    "service",
+			service: "web",
+			want:    portForwardTarget{Namespace: "default", Service: "web"},
+		},
+		{
+			name:      "service in the namespace",
+			namespace: "app",
+			service:   "web",
+			want:      portForwardTarget{Namespace: "app", Service: "web"},
+		},
+		{
+			name:    "service in NAMESPACE/NAME",
+			service: "app/web",
+			want:    portForwardTarget{Namespace: "app", Service: "web"},
+		},
+		{
+			name:      "NAMESPACE/NAME that agrees with -namespace",
+			namespace: "app",
+			pod:       "app/web-0",
+			want:      portForwardTarget{Namespace: "app", Pod: "web-0"},
+		},
+		{
+			name:      "NAMESPACE/NAME that conflicts with -namespace",
+			namespace: "app",
+			pod:       "other/web-0",
+			wantErr:   `namespace "other" in "other/web-0" conflicts with -namespace "app"`,
+		},
+		{
+			name: "pod in NAMESPACE/NAME",
+			pod:  "kube-system/coredns-0",
+			want: portForwardTarget{Namespace: "kube-system", Pod: "coredns-0"},
+		},
+		{
+			name:      "selector",
+			namespace: "app",
+			sel:       "app=web",
+			want:      portForwardTarget{Namespace: "app", Selector: "app=web"},
+		},
+		{
+			name: "nothing",
+			want: portForwardTarget{Namespace: "default"},
+		},
+		{
+			name:    "service and pod",
+			service: "web",
+			pod:     "web-0",
+			wantErr: "only one of -service, -pod and -selector can be specified, but got -pod, -service",
+		},
+		{
+			name:    "all",
+			service: "web",
+			pod:     "web-0",
+			sel:     "app=web",
+			wantErr: "but got -pod, -selector, -service",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newPortForwardTarget(tc.namespace, tc.service, tc.pod, tc.sel)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: want %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("unexpected target: want %+v, got %+v", tc.want, got)
+			}
+
+			if got.IsZero() != (tc.service == "" && tc.pod == "" && tc.sel == "") {
+				t.Errorf("unexpected IsZero of %+v", got)
+			}
+		})
+	}
+}
@@ -2,41 +2,40 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
+	"github.com/mumoshu/wy/aws/pkg/ekstoken"
 	"github.com/mumoshu/wy/pkg/argocd"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/exec"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-func getRestConfig(kubeconfig string, argocdClusterSecret string) (*rest.Config, error) {
-	restConfig, err := argocd.NewRestConfig(kubeconfig)
-	if err != nil {
-		return nil, err
+func getRestConfig(kubeconfig string, argocdCluster argocdClusterFlags) (*rest.Config, error) {
+	if argocdCluster.isZero() {
+		return argocd.NewRestConfig(kubeconfig)
 	}
 
-	if argocdClusterSecret != "" {
-		cluster, err := getCluster(restConfig, argocdClusterSecret)
-		if err != nil {
-			return nil, err
-		}
-
-		// cluster.RestConfig() rewrites the exec provider and tls config in order to
-		// force the use of a custom transport.
-		restConfig = cluster.RESTConfig()
+	cluster, err := getCluster(kubeconfig, argocdCluster)
+	if err != nil {
+		return nil, err
 	}
 
-	return restConfig, nil
+	// cluster.RestConfig() rewrites the exec provider and tls config in order to
+	// force the use of a custom transport.
+	return cluster.restConfig(argocdCluster.awsAuth)
 }
 
-func getClusterRestConfig(kubeconfig string, argocdClusterSecret string) (*rest.Config, error) {
-	restConfig, err := argocd.NewRestConfig(kubeconfig)
-	if err != nil {
-		return nil, err
+func getClusterRestConfig(kubeconfig string, argocdCluster argocdClusterFlags) (*rest.Config, error) {
+	if argocdCluster.isZero() {
+		return argocd.NewRestConfig(kubeconfig)
 	}
 
-	cluster, err := getCluster(restConfig, argocdClusterSecret)
+	cluster, err := getCluster(kubeconfig, argocdCluster)
 	if err != nil {
 		return nil, err
 	}
@@ -50,13 +49,14 @@ func getClusterRestConfig(kubeconfig string, argocdClusterSecret string) (*rest.
 	// SetK8SConfigDefaults() removes the config details as explained in the first paragraph hence
 	// this keeps the details.
 
-	clusterRestConfig := cluster.RawRestConfig()
-
-	return clusterRestConfig, nil
+	return cluster.rawRestConfig(argocdCluster.awsAuth)
 }
 
-func getKubeconfig(kubeconfig string, argocdClusterSecret string, setNamespace string) ([]byte, error) {
-	clusterRestConfig, err := getClusterRestConfig(kubeconfig, argocdClusterSecret)
+func getKubeconfig(kubeconfig string, argocdCluster argocdClusterFlags, setNamespace string) ([]byte, error) {
+	// The kubeconfig may be used outside of wy, where the in-process token generation is unavailable
+	argocdCluster.awsAuth = awsAuthExec
+
+	clusterRestConfig, err := getClusterRestConfig(kubeconfig, argocdCluster)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +69,216 @@ func getKubeconfig(kubeconfig string, argocdClusterSecret string, setNamespace s
 	return kubeconfigData, nil
 }
 
-func getCluster(restConfig *rest.Config, argocdClusterSecret string) (*argocd.Cluster, error) {
+// getMergedKubeconfig adds a cluster, a user and a context for each of the clusters selected by the flags to the kubeconfig.
+// When all is true, it adds all the clusters in the cluster source that match -argocd-cluster and -argocd-cluster-selector, if any.
+// The entries are named after Cluster.Name, or the name of the cluster secret when Cluster.Name is empty.
+func getMergedKubeconfig(kubeconfig string, argocdCluster argocdClusterFlags, all bool, setNamespace string, config *clientcmdapi.Config) error {
+	var clusters []clusterSecret
+
+	if all {
+		if argocdCluster.secret != "" {
+			return fmt.Errorf("-all cannot be used with -argocd-cluster-secret")
+		}
+
+		source, err := newClusterSource(argocdCluster.source, kubeconfig, argocdCluster.namespace)
+		if err != nil {
+			return err
+		}
+
+		clusters, err = listClusters(source)
+		if err != nil {
+			return err
+		}
+
+		clusters, err = selectClusters(clusters, argocdCluster)
+		if err != nil {
+			return err
+		}
+	} else {
+		cluster, err := getCluster(kubeconfig, argocdCluster)
+		if err != nil {
+			return err
+		}
+
+		clusters = append(clusters, *cluster)
+	}
+
+	names := map[string]string{}
+
+	for _, c := range clusters {
+		name := c.Cluster.Name
+		if name == "" {
+			name = c.Name
+		}
+
+		if name == "" {
+			return fmt.Errorf("unable to determine the name of the cluster %s. Specify the cluster with -argocd-cluster-secret", c.Cluster.Server)
+		}
+
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("cluster secrets %s and %s have the same cluster name %q", other, c.Name, name)
+		}
+
+		names[name] = c.Name
+
+		// See getClusterRestConfig for why we use RawRestConfig
+		clusterRestConfig, err := c.rawRestConfig(awsAuthExec)
+		if err != nil {
+			return fmt.Errorf("cluster secret %s: %w", c.Name, err)
+		}
+
+		argocd.AddToKubeConfig(config, name, clusterRestConfig, setNamespace)
+
+		if config.CurrentContext == "" {
+			config.CurrentContext = name
+		}
+	}
+
+	return nil
+}
+
+// getCluster returns the cluster selected by the flags, read from the cluster source.
+// It fails when the flags select no cluster or more than one cluster.
+func getCluster(kubeconfig string, argocdCluster argocdClusterFlags) (*clusterSecret, error) {
+	source, err := newClusterSource(argocdCluster.source, kubeconfig, argocdCluster.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if argocdCluster.secret == "" {
+		clusters, err := listClusters(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return selectOneCluster(clusters, argocdCluster)
+	}
+
+	name := argocdCluster.secret
+	if argocdCluster.isSecretSource() {
+		ns, n := argocdCluster.secretNamespacedName()
+		name = ns + "/" + n
+	}
+
+	c, err := source.GetCluster(context.TODO(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterSecret{Namespace: c.Namespace, Name: c.Name, Cluster: c.Cluster, RestConfig: c.RestConfig}, nil
+}
+
+// getClusters returns the cluster named by -argocd-cluster-secret,
+// or all the clusters in the cluster source that match -argocd-cluster and -argocd-cluster-selector.
+func getClusters(kubeconfig string, argocdCluster argocdClusterFlags) ([]clusterSecret, error) {
+	if argocdCluster.secret != "" {
+		c, err := getCluster(kubeconfig, argocdCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		return []clusterSecret{*c}, nil
+	}
+
+	source, err := newClusterSource(argocdCluster.source, kubeconfig, argocdCluster.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := listClusters(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectClusters(clusters, argocdCluster)
+}
+
+// selectOneCluster returns the only cluster selected by -argocd-cluster and -argocd-cluster-selector.
+// It fails when the flags select no cluster or more than one cluster.
+func selectOneCluster(clusters []clusterSecret, argocdCluster argocdClusterFlags) (*clusterSecret, error) {
+	selected, err := selectClusters(clusters, argocdCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(selected) {
+	case 0:
+		return nil, fmt.Errorf("no ArgoCD clusters in %s matched %s", argocdCluster.where(), argocdCluster)
+	case 1:
+		return &selected[0], nil
+	}
+
+	var names []string
+	for _, c := range selected {
+		name := c.Name
+		if name == "" {
+			name = c.Cluster.Name
+		}
+		names = append(names, name)
+	}
+
+	return nil, fmt.Errorf("%s matched more than one ArgoCD cluster: %s", argocdCluster, strings.Join(names, ", "))
+}
+
+// clusterSecret is an ArgoCD cluster secret converted into a Cluster, or a cluster read from another ClusterSource.
+// Namespace is empty for the clusters read from sources other than the cluster secrets.
+// Namespace and Name are empty when the cluster is fetched from the ArgoCD API server,
+// in which case the credentials in the Cluster are redacted.
+// RestConfig is set when the source has the rest config of its own, like the kubeconfig does.
+type clusterSecret struct {
+	Namespace  string
+	Name       string
+	Cluster    *argocd.Cluster
+	RestConfig *rest.Config
+}
+
+// ref returns the value of -argocd-cluster-secret that selects the cluster,
+// which is NAMESPACE/NAME for the cluster secrets and the name of the cluster in the source otherwise.
+func (c clusterSecret) ref() string {
+	if c.Namespace == "" {
+		return c.Name
+	}
+
+	return c.Namespace + "/" + c.Name
+}
+
+// rawRestConfig returns a copy of RestConfig when it's set, or clusterRawRestConfig(c.Cluster, awsAuth) otherwise.
+func (c clusterSecret) rawRestConfig(awsAuth string) (*rest.Config, error) {
+	if c.RestConfig != nil {
+		return rest.CopyConfig(c.RestConfig), nil
+	}
+
+	return clusterRawRestConfig(c.Cluster, awsAuth)
+}
+
+// restConfig returns a copy of RestConfig when it's set, or clusterRESTConfig(c.Cluster, awsAuth) otherwise.
+// RestConfig is returned as is, because the ArgoCD defaults would drop the details like the auth provider.
+func (c clusterSecret) restConfig(awsAuth string) (*rest.Config, error) {
+	if c.RestConfig != nil {
+		return rest.CopyConfig(c.RestConfig), nil
+	}
+
+	return clusterRESTConfig(c.Cluster, awsAuth)
+}
+
+// listClusters returns all the clusters in the cluster source.
+func listClusters(source argocd.ClusterSource) ([]clusterSecret, error) {
+	items, err := source.ListClusters(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []clusterSecret
+
+	for _, c := range items {
+		clusters = append(clusters, clusterSecret{Namespace: c.Namespace, Name: c.Name, Cluster: c.Cluster, RestConfig: c.RestConfig})
+	}
+
+	return clusters, nil
+}
+
+// listClusterSecrets returns all the ArgoCD cluster secrets in the namespace, without converting them into clusters.
+func listClusterSecrets(restConfig *rest.Config, namespace string) ([]corev1.Secret, error) {
 	c, err := argocd.NewClientSet(restConfig)
 	if err != nil {
 		return nil, err
@@ -77,27 +286,85 @@ func getCluster(restConfig *rest.Config, argocdClusterSecret string) (*argocd.Cl
 
 	ctx := context.TODO()
 
-	nsName := strings.Split(argocdClusterSecret, "/")
+	secrets, err := c.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: argocd.LabelKeySecretType + "=" + argocd.LabelValueSecretTypeCluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets.Items, nil
+}
 
-	var ns, name string
+// splitNamespacedName splits NAMESPACE/NAME into the namespace and the name.
+// The namespace defaults to defaultNamespace when the NAMESPACE/ part is omitted.
+func splitNamespacedName(s string, defaultNamespace string) (string, string) {
+	nsName := strings.SplitN(s, "/", 2)
 
 	if len(nsName) == 1 {
-		ns = "default"
-		name = nsName[0]
-	} else {
-		ns = nsName[0]
-		name = nsName[1]
+		return defaultNamespace, nsName[0]
 	}
 
-	secret, err := c.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
-	if err != nil {
+	return nsName[0], nsName[1]
+}
+
+// clusterRawRestConfig returns cluster.RawRestConfig(), turning its panic into an error.
+// With awsAuthInProcess, the exec provider for awsAuthConfig is replaced with the in-process token generation.
+func clusterRawRestConfig(cluster *argocd.Cluster, awsAuth string) (config *rest.Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	config = cluster.RawRestConfig()
+
+	if err := setAWSAuth(config, cluster, awsAuth); err != nil {
 		return nil, err
 	}
 
-	cluster, err := argocd.SecretToCluster(secret)
+	return config, nil
+}
+
+// clusterRESTConfig returns cluster.RESTConfig(), turning its panic into an error.
+// With awsAuthInProcess, the exec provider for awsAuthConfig is replaced with the in-process token generation.
+func clusterRESTConfig(cluster *argocd.Cluster, awsAuth string) (*rest.Config, error) {
+	config, err := clusterRawRestConfig(cluster, awsAuth)
 	if err != nil {
 		return nil, err
 	}
 
-	return cluster, nil
+	if err := argocd.SetK8SConfigDefaults(config); err != nil {
+		return nil, fmt.Errorf("applying K8s REST config defaults: %w", err)
+	}
+
+	return config, nil
+}
+
+// setAWSAuth replaces the exec provider that runs `aws eks get-token` with the in-process token generation
+// when awsAuth is awsAuthInProcess and the cluster has awsAuthConfig.
+func setAWSAuth(config *rest.Config, cluster *argocd.Cluster, awsAuth string) error {
+	switch awsAuth {
+	case "", awsAuthExec:
+		return nil
+	case awsAuthInProcess:
+	default:
+		return fmt.Errorf("unsupported value for -aws-auth: %q. It must be one of %s or %s", awsAuth, awsAuthExec, awsAuthInProcess)
+	}
+
+	aws := cluster.Config.AWSAuthConfig
+	if aws == nil || cluster.Server == argocd.KubernetesInternalAPIServerAddr {
+		return nil
+	}
+
+	ts := &ekstoken.TokenSource{
+		ClusterName: aws.ClusterName,
+		RoleARN:     aws.RoleARN,
+		Profile:     aws.Profile,
+	}
+
+	config.ExecProvider = nil
+	config.Wrap(ts.WrapTransport)
+
+	return nil
 }
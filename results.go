@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of the repeat command
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// requestResult is the result of a request that is printed with -output json.
+type requestResult struct {
+	Cluster   string `json:"cluster,omitempty"`
+	URL       string `json:"url"`
+	Pod       string `json:"pod,omitempty"`
+	LocalPort int    `json:"localPort,omitempty"`
+	Code      int    `json:"code,omitempty"`
+	Body      string `json:"body,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// podResult aggregates the results of requests sent to a pod.
+type podResult struct {
+	Cluster   string      `json:"cluster,omitempty"`
+	Pod       string      `json:"pod"`
+	LocalPort int         `json:"localPort"`
+	Requests  int         `json:"requests"`
+	Errors    int         `json:"errors"`
+	Codes     map[int]int `json:"codes,omitempty"`
+}
+
+func (r *podResult) record(code int, err error) {
+	r.Requests++
+
+	if err != nil {
+		r.Errors++
+		return
+	}
+
+	if r.Codes == nil {
+		r.Codes = map[int]int{}
+	}
+
+	r.Codes[code]++
+}
+
+func (r *podResult) codesString() string {
+	var codes []int
+	for c := range r.Codes {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+
+	var s []string
+	for _, c := range codes {
+		s = append(s, fmt.Sprintf("%d:%d", c, r.Codes[c]))
+	}
+
+	if len(s) == 0 {
+		return "-"
+	}
+
+	return strings.Join(s, ",")
+}
+
+func printPodResults(out io.Writer, results []*podResult) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "POD\tLOCAL PORT\tREQUESTS\tERRORS\tCODES")
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", r.Pod, r.LocalPort, r.Requests, r.Errors, r.codesString())
+	}
+
+	return w.Flush()
+}
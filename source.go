@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+	"k8s.io/client-go/util/homedir"
+)
+
+// The kinds of the cluster sources that are selected with the -cluster-source flag, in the form of KIND or KIND:ARG.
+const (
+	// clusterSourceSecrets reads the ArgoCD cluster secrets in -argocd-namespace, which is the default
+	clusterSourceSecrets = "argocd-secrets"
+	// clusterSourceKubeconfig reads the contexts of the kubeconfig file at ARG, or the one given by -kubeconfig when ARG is omitted
+	clusterSourceKubeconfig = "kubeconfig"
+	// clusterSourceDir reads the cluster JSON files in the directory at ARG
+	clusterSourceDir = "dir"
+	// clusterSourceVault reads the secrets under the Vault KV path ARG, like secret/clusters
+	clusterSourceVault = "vault"
+)
+
+const clusterSourceUsage = "Where to read the clusters and their credentials from. One of argocd-secrets, kubeconfig[:PATH], dir:PATH, and vault:PATH. " +
+	"vault reads the secrets under the KV secrets engine path like secret/clusters, with VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE"
+
+// newClusterSource returns the ClusterSource specified in the form of KIND or KIND:ARG.
+// The ArgoCD cluster secrets in the namespace are read with the kubeconfig, or the in-cluster config when it doesn't exist.
+// The kubeconfig source without ARG reads the contexts of the kubeconfig, which defaults to KUBECONFIG or ~/.kube/config.
+func newClusterSource(spec, kubeconfig, namespace string) (argocd.ClusterSource, error) {
+	kind, arg := spec, ""
+	if kv := strings.SplitN(spec, ":", 2); len(kv) == 2 {
+		kind, arg = kv[0], kv[1]
+	}
+
+	switch kind {
+	case "", clusterSourceSecrets:
+		restConfig, err := argocd.NewRestConfig(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := argocd.NewClientSet(restConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return &argocd.SecretClusterSource{Clientset: c, Namespace: namespace}, nil
+	case clusterSourceKubeconfig:
+		if arg == "" {
+			arg = kubeconfig
+		}
+
+		return &argocd.KubeconfigClusterSource{Path: arg}, nil
+	case clusterSourceDir:
+		if arg == "" {
+			return nil, fmt.Errorf("invalid value for -cluster-source: %q. Specify the directory like %s:PATH", spec, clusterSourceDir)
+		}
+
+		return &argocd.DirClusterSource{Dir: arg}, nil
+	case clusterSourceVault:
+		if arg == "" {
+			return nil, fmt.Errorf("invalid value for -cluster-source: %q. Specify the Vault path like %s:secret/clusters", spec, clusterSourceVault)
+		}
+
+		token, err := vaultToken()
+		if err != nil {
+			return nil, err
+		}
+
+		return argocd.NewVaultClusterSource(os.Getenv("VAULT_ADDR"), token, os.Getenv("VAULT_NAMESPACE"), arg)
+	default:
+		return nil, fmt.Errorf("unsupported value for -cluster-source: %q. It must be one of %s, %s[:PATH], %s:PATH, and %s:PATH",
+			spec, clusterSourceSecrets, clusterSourceKubeconfig, clusterSourceDir, clusterSourceVault)
+	}
+}
+
+// vaultToken returns VAULT_TOKEN, or the token in ~/.vault-token written by `vault login`, like the vault CLI does.
+func vaultToken() (string, error) {
+	if t := os.Getenv("VAULT_TOKEN"); t != "" {
+		return t, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(homedir.HomeDir(), ".vault-token"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mumoshu/wy/pkg/argocd"
+)
+
+func TestNewClusterSourceKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+
+	// writeKubeconfig writes a kubeconfig that has a context of the name, and returns the path
+	writeKubeconfig := func(name string) string {
+		path := filepath.Join(dir, name)
+		data := "apiVersion: v1\nkind: Config\nclusters:\n- name: c\n  cluster:\n    server: https://" + name + ".example.com\nusers:\n- name: u\n  user:\n    token: t\ncontexts:\n- name: " + name + "\n  context:\n    cluster: c\n    user: u\ncurrent-context: " + name + "\n"
+
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	t.Setenv("KUBECONFIG", writeKubeconfig("env"))
+	t.Setenv("HOME", dir)
+
+	flagPath := writeKubeconfig("flag")
+	arg := writeKubeconfig("arg")
+
+	testcases := []struct {
+		name       string
+		spec       string
+		kubeconfig string
+		want       string
+	}{
+		{name: "ARG", spec: "kubeconfig:" + arg, kubeconfig: flagPath, want: "arg"},
+		{name: "-kubeconfig without ARG", spec: "kubeconfig", kubeconfig: flagPath, want: "flag"},
+		{name: "KUBECONFIG without ARG and -kubeconfig", spec: "kubeconfig", want: "env"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newClusterSource(tc.spec, tc.kubeconfig, "argocd")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := s.(*argocd.KubeconfigClusterSource); !ok {
+				t.Fatalf("unexpected source: %T", s)
+			}
+
+			clusters, err := s.ListClusters(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(clusters) != 1 || clusters[0].Name != tc.want {
+				t.Errorf("unexpected clusters: want the context %s, got %+v", tc.want, clusters)
+			}
+		})
+	}
+}